@@ -0,0 +1,269 @@
+package fetch
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Authenticator applies credentials to a request right before it is sent.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// ChallengeResponder is an Authenticator able to answer a 401 challenge,
+// when Challenge returns true the request is authenticated and sent again.
+type ChallengeResponder interface {
+	Authenticator
+	Challenge(req *http.Request, rsp *http.Response) (bool, error)
+}
+
+// AuthenticatorFunc use an ordinary function as Authenticator.
+type AuthenticatorFunc func(req *http.Request) error
+
+// Authenticate call f(req).
+func (f AuthenticatorFunc) Authenticate(req *http.Request) error {
+	return f(req)
+}
+
+// BasicAuth authenticate requests with HTTP Basic credentials.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// Authenticate set the Authorization header with Basic credentials.
+func (a BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+// BearerAuth authenticate requests with a static Bearer token.
+type BearerAuth struct {
+	Token string
+}
+
+// Authenticate set the Authorization header with the Bearer token.
+func (a BearerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// APIKeyLocation defines where the API key is sent.
+type APIKeyLocation int
+
+const (
+	// APIKeyInHeader send the key as request header
+	APIKeyInHeader APIKeyLocation = iota
+	// APIKeyInQuery send the key as query string parameter
+	APIKeyInQuery
+)
+
+// APIKeyAuth authenticate requests with an API key in header or query.
+type APIKeyAuth struct {
+	Name  string
+	Value string
+	In    APIKeyLocation
+}
+
+// Authenticate add the API key in the request.
+func (a APIKeyAuth) Authenticate(req *http.Request) error {
+	if a.In == APIKeyInQuery {
+		query := req.URL.Query()
+		query.Set(a.Name, a.Value)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+
+	req.Header.Set(a.Name, a.Value)
+	return nil
+}
+
+// DefaultTimestampHeader is the header used by HMACAuth to send the signing time
+const DefaultTimestampHeader = "X-Timestamp"
+
+// HMACAuth sign requests with a shared secret.
+// The signature covers the method, path, sorted query, selected headers,
+// the timestamp and the SHA-256 digest of the body, it's sent as:
+//
+//	Authorization: HMAC keyId="id",algorithm="hmac-sha256",headers="host x-foo",signature="base64"
+type HMACAuth struct {
+	KeyID  string
+	Secret []byte
+
+	// Headers lists the header names covered by the signature, "host" is allowed.
+	Headers []string
+
+	// Hash used for the signature, sha256.New by default.
+	Hash func() hash.Hash
+	// Algorithm name sent in Authorization, "hmac-sha256" by default.
+	Algorithm string
+	// TimestampHeader defaults to DefaultTimestampHeader.
+	TimestampHeader string
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Authenticate add the timestamp and Authorization headers.
+func (a HMACAuth) Authenticate(req *http.Request) error {
+	now := time.Now
+	if a.Now != nil {
+		now = a.Now
+	}
+
+	timestampHeader := a.TimestampHeader
+	if timestampHeader == "" {
+		timestampHeader = DefaultTimestampHeader
+	}
+
+	timestamp := strconv.FormatInt(now().Unix(), 10)
+	req.Header.Set(timestampHeader, timestamp)
+
+	signature, err := a.Sign(req, timestamp)
+	if err != nil {
+		return err
+	}
+
+	algorithm := a.Algorithm
+	if algorithm == "" {
+		algorithm = "hmac-sha256"
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(`HMAC keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		a.KeyID, algorithm, strings.Join(a.signedHeaders(), " "), signature))
+	return nil
+}
+
+// Sign return the base64 signature of request for the timestamp given,
+// servers can use it to verify incoming requests.
+func (a HMACAuth) Sign(req *http.Request, timestamp string) (string, error) {
+	canonical, err := a.canonicalString(req, timestamp)
+	if err != nil {
+		return "", err
+	}
+
+	hashFunc := a.Hash
+	if hashFunc == nil {
+		hashFunc = sha256.New
+	}
+
+	mac := hmac.New(hashFunc, a.Secret)
+	mac.Write([]byte(canonical))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// signedHeaders return the lower case header names covered by signature
+func (a HMACAuth) signedHeaders() []string {
+	names := make([]string, len(a.Headers))
+	for i, name := range a.Headers {
+		names[i] = strings.ToLower(name)
+	}
+	return names
+}
+
+// canonicalString build the string to sign, one element per line
+func (a HMACAuth) canonicalString(req *http.Request, timestamp string) (string, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(body)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	lines := []string{req.Method, path, sortedQuery(req.URL.Query())}
+	for _, name := range a.signedHeaders() {
+		lines = append(lines, name+":"+headerValue(req, name))
+	}
+	lines = append(lines, timestamp, hex.EncodeToString(digest[:]))
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// sortedQuery encode query sorted by key and then by value
+func sortedQuery(query map[string][]string) string {
+	encoded := make(map[string][]string, len(query))
+	keys := make([]string, 0, len(query))
+	for key, values := range query {
+		key = queryEscape(key)
+		keys = append(keys, key)
+		for _, value := range values {
+			encoded[key] = append(encoded[key], queryEscape(value))
+		}
+		sort.Strings(encoded[key])
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(query))
+	for _, key := range keys {
+		for _, value := range encoded[key] {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// queryEscape escape as RFC 3986 unreserved characters
+func queryEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// headerValue return trimmed values of header joined by comma, host is read from request
+func headerValue(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+
+	values := req.Header[http.CanonicalHeaderKey(name)]
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.Join(strings.Fields(value), " ")
+	}
+	return strings.Join(trimmed, ",")
+}
+
+// readBody return a copy of request body and rewind it so it can still be sent
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	bs, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(bs))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(bs)), nil
+	}
+	return bs, nil
+}
@@ -0,0 +1,129 @@
+package fetch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticators(t *testing.T) {
+	tests := []struct {
+		desc   string
+		auth   Authenticator
+		header string
+		query  string
+		output string
+	}{
+		{desc: "Basic", auth: BasicAuth{Username: "rodkranz", Password: "secret"}, header: "Authorization", output: "Basic cm9ka3Jhbno6c2VjcmV0"},
+		{desc: "Bearer", auth: BearerAuth{Token: "token"}, header: "Authorization", output: "Bearer token"},
+		{desc: "APIKeyHeader", auth: APIKeyAuth{Name: "X-Api-Key", Value: "key"}, header: "X-Api-Key", output: "key"},
+		{desc: "APIKeyQuery", auth: APIKeyAuth{Name: "api_key", Value: "key", In: APIKeyInQuery}, query: "api_key", output: "key"},
+		{desc: "Func", auth: AuthenticatorFunc(func(req *http.Request) error {
+			req.Header.Set("X-Custom", "custom")
+			return nil
+		}), header: "X-Custom", output: "custom"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var output string
+			s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+				if test.query != "" {
+					output = r.URL.Query().Get(test.query)
+					return
+				}
+				output = r.Header.Get(test.header)
+			})
+			defer s.Close()
+
+			opt := DefaultOptions()
+			opt.Auth = test.auth
+			if _, err := New(opt).Get(s.URL+"?page=1", nil); err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+
+			if output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+			if len(opt.Header) != 0 {
+				t.Errorf("Expected default header untouched, but got [%v]", opt.Header)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorError(t *testing.T) {
+	opt := DefaultOptions()
+	opt.Auth = AuthenticatorFunc(func(req *http.Request) error {
+		return fmt.Errorf("no credentials")
+	})
+
+	rsp, err := New(opt).Get("http://localhost", nil)
+	if err == nil {
+		t.Fatal("Expected error, but got none error")
+	}
+	if http.StatusNoContent != rsp.StatusCode {
+		t.Errorf("Expected status code [%d], but got [%d]", http.StatusNoContent, rsp.StatusCode)
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	auth := HMACAuth{
+		KeyID:   "key-1",
+		Secret:  []byte("secret"),
+		Headers: []string{"Host", "Content-Type"},
+		Now:     func() time.Time { return time.Unix(1578268800, 0) },
+	}
+
+	t.Run("Test-CanonicalString", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/users?b=2&a=1&a=0", strings.NewReader("body"))
+		req.Header.Set("Content-Type", "  application/json ")
+
+		canonical, err := auth.canonicalString(req, "1578268800")
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+
+		expected := strings.Join([]string{
+			"POST",
+			"/users",
+			"a=0&a=1&b=2",
+			"host:example.com",
+			"content-type:application/json",
+			"1578268800",
+			"230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5",
+		}, "\n")
+		if canonical != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, canonical)
+		}
+	})
+
+	t.Run("Test-Verify", func(t *testing.T) {
+		s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+			signature, err := auth.Sign(r, r.Header.Get(DefaultTimestampHeader))
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+
+			expected := fmt.Sprintf(`HMAC keyId="key-1",algorithm="hmac-sha256",headers="host content-type",signature="%s"`, signature)
+			if got := r.Header.Get("Authorization"); got != expected {
+				t.Errorf("Expected [%s], but got [%s]", expected, got)
+			}
+			if body := MustBytes(ioutil.ReadAll(r.Body)); string(body) != `{"name":"rodkranz"}` {
+				t.Errorf("Expected body still readable, but got [%s]", body)
+			}
+		})
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Auth = auth
+		_, err := New(opt).IsJSON().Post(s.URL+"/users?z=1", NewReader(map[string]string{"name": "rodkranz"}))
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+	})
+}
@@ -0,0 +1,392 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of LoadBalancerOptions.
+const (
+	DefaultMaxFailures         = 3
+	DefaultEjectionTime        = 30 * time.Second
+	DefaultLoadBalancerRetries = 2
+)
+
+// hashReplicas is the number of points of an endpoint of weight 1 in the hash ring
+const hashReplicas = 100
+
+// BalanceStrategy selects the endpoint of each request.
+type BalanceStrategy int
+
+const (
+	// BalanceRoundRobin uses the endpoints in turn
+	BalanceRoundRobin BalanceStrategy = iota
+	// BalanceLeastInFlight uses the endpoint with fewer requests in flight,
+	// requests are in flight until their response body is read or closed
+	BalanceLeastInFlight
+	// BalanceWeighted uses the endpoints in turn proportionally to their weight
+	BalanceWeighted
+	// BalanceConsistentHash uses the endpoint of the key set with WithBalanceKey,
+	// the same key keeps the same endpoint while it's healthy. Requests without
+	// key are balanced in turn.
+	BalanceConsistentHash
+)
+
+// Endpoint is a replica requests are balanced to.
+type Endpoint struct {
+	// URL is the base URL of endpoint, eg. https://10.0.0.1:8443, its path
+	// prefixes the path of requests.
+	URL string
+	// Weight is used by BalanceWeighted and BalanceConsistentHash, 1 when zero.
+	Weight int
+}
+
+// LoadBalancerOptions balance requests between endpoints: the scheme and host of
+// request URL are replaced by the endpoint, so requests can use URLs such as
+// "/users/1". Authenticators sign the request URL before balancing.
+//
+// Endpoints failing MaxFailures times in a row, with a connection error or a 5xx
+// status, are ejected for EjectionTime. When every endpoint is ejected they are
+// all used. The options keep the endpoint state, share them only between clients
+// of the same service.
+type LoadBalancerOptions struct {
+	Endpoints []Endpoint
+	Strategy  BalanceStrategy
+	// MaxFailures is the number of consecutive failures ejecting an endpoint,
+	// DefaultMaxFailures when zero.
+	MaxFailures int
+	// EjectionTime is the time an endpoint stays ejected, DefaultEjectionTime when zero.
+	EjectionTime time.Duration
+	// Retries is the number of other endpoints tried after a connection error,
+	// DefaultLoadBalancerRetries when zero and none when negative. Requests which
+	// aren't idempotent are retried only when the connection couldn't be opened.
+	Retries int
+
+	once      sync.Once
+	err       error
+	endpoints []*endpoint
+	ring      []hashPoint
+	next      uint32
+
+	mu sync.Mutex
+}
+
+// EndpointStatus is the state of an endpoint.
+type EndpointStatus struct {
+	URL string
+	// InFlight is the number of requests whose response body isn't read or closed.
+	InFlight int64
+	// Failures is the number of consecutive failures.
+	Failures int
+	// EjectedUntil is set while the endpoint is ejected.
+	EjectedUntil time.Time
+	// Healthy is false while the health checks of HealthCheckOptions fail.
+	Healthy bool
+}
+
+// endpoint keeps the state of an Endpoint
+type endpoint struct {
+	inFlight int64
+
+	url    *url.URL
+	weight int
+
+	// failures, ejectedUntil, unhealthy and current are guarded by LoadBalancerOptions.mu
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool
+	current      int
+}
+
+// hashPoint is a point of the consistent hash ring
+type hashPoint struct {
+	hash     uint32
+	endpoint *endpoint
+}
+
+// balanceKey is the context key of consistent hash key
+type balanceKey struct{}
+
+// WithBalanceKey returns a copy of ctx whose requests are balanced by key
+// with BalanceConsistentHash, eg. a user or tenant ID.
+func WithBalanceKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, balanceKey{}, key)
+}
+
+// init parses the endpoints and builds the hash ring
+func (o *LoadBalancerOptions) init() error {
+	o.once.Do(func() {
+		if len(o.Endpoints) == 0 {
+			o.err = errors.New("load balancer without endpoints")
+			return
+		}
+
+		for _, e := range o.Endpoints {
+			u, err := url.Parse(e.URL)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				o.err = fmt.Errorf("invalid endpoint %q", e.URL)
+				return
+			}
+			weight := e.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			o.endpoints = append(o.endpoints, &endpoint{url: u, weight: weight})
+		}
+
+		for _, e := range o.endpoints {
+			for i := 0; i < hashReplicas*e.weight; i++ {
+				o.ring = append(o.ring, hashPoint{hash: hashKey(e.url.String() + "#" + strconv.Itoa(i)), endpoint: e})
+			}
+		}
+		sort.Slice(o.ring, func(i, j int) bool { return o.ring[i].hash < o.ring[j].hash })
+	})
+	return o.err
+}
+
+// Status returns the state of endpoints, in the order of Endpoints.
+func (o *LoadBalancerOptions) Status() []EndpointStatus {
+	if o.init() != nil {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	status := make([]EndpointStatus, len(o.endpoints))
+	for i, e := range o.endpoints {
+		status[i] = EndpointStatus{
+			URL:      e.url.String(),
+			InFlight: atomic.LoadInt64(&e.inFlight),
+			Failures: e.failures,
+			Healthy:  !e.unhealthy,
+		}
+		if time.Now().Before(e.ejectedUntil) {
+			status[i].EjectedUntil = e.ejectedUntil
+		}
+	}
+	return status
+}
+
+// pick returns the endpoint of a request, skipping the endpoints tried
+func (o *LoadBalancerOptions) pick(ctx context.Context, tried map[*endpoint]bool) *endpoint {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*endpoint, 0, len(o.endpoints))
+	for _, e := range o.endpoints {
+		if !tried[e] && !e.unhealthy && !now.Before(e.ejectedUntil) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		// every endpoint is ejected or unhealthy, they are all used
+		for _, e := range o.endpoints {
+			if !tried[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch o.Strategy {
+	case BalanceLeastInFlight:
+		start := int(o.nextIndex())
+		best := candidates[start%len(candidates)]
+		for i := range candidates {
+			e := candidates[(start+i)%len(candidates)]
+			if atomic.LoadInt64(&e.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = e
+			}
+		}
+		return best
+
+	case BalanceWeighted:
+		// smooth weighted round-robin
+		total := 0
+		var best *endpoint
+		for _, e := range candidates {
+			e.current += e.weight
+			total += e.weight
+			if best == nil || e.current > best.current {
+				best = e
+			}
+		}
+		best.current -= total
+		return best
+
+	case BalanceConsistentHash:
+		if key, ok := ctx.Value(balanceKey{}).(string); ok {
+			allowed := make(map[*endpoint]bool, len(candidates))
+			for _, e := range candidates {
+				allowed[e] = true
+			}
+			h := hashKey(key)
+			i := sort.Search(len(o.ring), func(i int) bool { return o.ring[i].hash >= h })
+			for n := 0; n < len(o.ring); n++ {
+				if p := o.ring[(i+n)%len(o.ring)]; allowed[p.endpoint] {
+					return p.endpoint
+				}
+			}
+		}
+	}
+
+	return candidates[int(o.nextIndex())%len(candidates)]
+}
+
+// nextIndex returns the round-robin counter
+func (o *LoadBalancerOptions) nextIndex() uint32 {
+	return atomic.AddUint32(&o.next, 1) - 1
+}
+
+// report updates the passive health of e
+func (o *LoadBalancerOptions) report(e *endpoint, failed bool) {
+	maxFailures := o.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = DefaultMaxFailures
+	}
+	ejection := o.EjectionTime
+	if ejection <= 0 {
+		ejection = DefaultEjectionTime
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !failed {
+		e.failures = 0
+		return
+	}
+	e.failures++
+	if e.failures >= maxFailures {
+		e.ejectedUntil = time.Now().Add(ejection)
+		e.failures = 0
+	}
+}
+
+// setHealthy sets the state of the health checks of e
+func (o *LoadBalancerOptions) setHealthy(e *endpoint, healthy bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e.unhealthy = !healthy
+}
+
+// balance returns send balancing requests between the endpoints
+func (o *LoadBalancerOptions) balance(send sendFunc) sendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if err := o.init(); err != nil {
+			return nil, err
+		}
+
+		retries := o.Retries
+		if retries == 0 {
+			retries = DefaultLoadBalancerRetries
+		}
+		rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+		tried := map[*endpoint]bool{}
+		for attempt := 0; ; attempt++ {
+			e := o.pick(req.Context(), tried)
+			tried[e] = true
+
+			r := withBaseURL(req, e.url)
+			if attempt > 0 && req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+
+			atomic.AddInt64(&e.inFlight, 1)
+			resp, err := send(r)
+			if err != nil {
+				atomic.AddInt64(&e.inFlight, -1)
+				// a full bulkhead isn't a failure of endpoint, another one can be tried
+				o.report(e, req.Context().Err() == nil && !errors.Is(err, ErrBulkheadFull))
+
+				if attempt >= retries || len(tried) == len(o.endpoints) || req.Context().Err() != nil ||
+					!rewindable || !idempotent(req) && !isDialError(err) {
+					return nil, err
+				}
+				if info := infoFromContext(req.Context()); info != nil {
+					atomic.AddInt64(&info.retries, 1)
+				}
+				continue
+			}
+
+			o.report(e, resp.StatusCode >= http.StatusInternalServerError)
+			release := func() { atomic.AddInt64(&e.inFlight, -1) }
+			// the body of switching protocols is the connection itself, not a request
+			if resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+				release()
+			} else {
+				resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+			}
+			return resp, nil
+		}
+	}
+}
+
+// idempotent reports whether the method of req can be sent twice
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isDialError reports whether err happened opening the connection,
+// before the request was written
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// hashKey returns the FNV-1a hash of key, mixed with the murmur3 finalizer
+// so keys differing only in the last bytes spread over the ring
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum32()
+	x ^= x >> 16
+	x *= 0x85ebca6b
+	x ^= x >> 13
+	x *= 0xc2b2ae35
+	x ^= x >> 16
+	return x
+}
+
+// releaseBody calls release once when read entirely or closed
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// replicasMock starts servers answering their name
+func replicasMock(names ...string) ([]*httptest.Server, []Endpoint) {
+	servers := make([]*httptest.Server, len(names))
+	endpoints := make([]Endpoint, len(names))
+	for i, name := range names {
+		name := name
+		servers[i] = serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(name, "fail") {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			fmt.Fprint(w, name)
+		})
+		endpoints[i] = Endpoint{URL: servers[i].URL}
+	}
+	return servers, endpoints
+}
+
+func closeServers(servers []*httptest.Server) {
+	for _, s := range servers {
+		s.Close()
+	}
+}
+
+// balancedNames sends n requests and returns the names answered
+func balancedNames(t *testing.T, f *Fetch, ctx context.Context, n int) []string {
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		rsp, err := f.GetWithContext(ctx, "/name", nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		names = append(names, rsp.String())
+	}
+	return names
+}
+
+func TestLoadBalancerOptions_Strategy(t *testing.T) {
+	servers, endpoints := replicasMock("a", "b", "c")
+	defer closeServers(servers)
+
+	weighted := append([]Endpoint(nil), endpoints[:2]...)
+	weighted[0].Weight = 3
+
+	tests := []struct {
+		desc      string
+		strategy  BalanceStrategy
+		endpoints []Endpoint
+		expected  string
+	}{
+		{desc: "RoundRobin", strategy: BalanceRoundRobin, endpoints: endpoints, expected: "a,b,c,a,b,c,a,b"},
+		{desc: "Weighted", strategy: BalanceWeighted, endpoints: weighted, expected: "a,a,b,a,a,a,b,a"},
+		{desc: "ConsistentHashWithoutKey", strategy: BalanceConsistentHash, endpoints: endpoints, expected: "a,b,c,a,b,c,a,b"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.LoadBalancer = &LoadBalancerOptions{Endpoints: test.endpoints, Strategy: test.strategy}
+
+			names := balancedNames(t, New(opt), context.Background(), 8)
+			if output := strings.Join(names, ","); output != test.expected {
+				t.Errorf("Expected [%s], but got [%s]", test.expected, output)
+			}
+		})
+	}
+}
+
+func TestLoadBalancerOptions_ConsistentHash(t *testing.T) {
+	lb := &LoadBalancerOptions{
+		Endpoints: []Endpoint{{URL: "http://10.0.0.1:8080"}, {URL: "http://10.0.0.2:8080"}, {URL: "http://10.0.0.3:8080"}},
+		Strategy:  BalanceConsistentHash,
+	}
+	if err := lb.init(); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	const keys = 300
+	used := map[string]int{}
+	for i := 0; i < keys; i++ {
+		ctx := WithBalanceKey(context.Background(), fmt.Sprintf("user-%d", i))
+		e := lb.pick(ctx, nil)
+		if again := lb.pick(ctx, nil); again != e {
+			t.Errorf("Expected same endpoint for a key, but got [%s] and [%s]", e.url, again.url)
+		}
+		used[e.url.Host]++
+	}
+	for _, e := range lb.Endpoints {
+		if n := used[strings.TrimPrefix(e.URL, "http://")]; n < keys/5 {
+			t.Errorf("Expected keys spread between endpoints, but got [%v]", used)
+			break
+		}
+	}
+}
+
+func TestLoadBalancerOptions_LeastInFlight(t *testing.T) {
+	servers, endpoints := replicasMock("a", "b")
+	defer closeServers(servers)
+
+	lb := &LoadBalancerOptions{Endpoints: endpoints, Strategy: BalanceLeastInFlight}
+	opt := DefaultOptions()
+	opt.LoadBalancer = lb
+	f := New(opt)
+
+	req, _ := NewRequest(http.MethodGet, "/name", nil)
+	open, err := f.Do(req)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if status := lb.Status(); status[0].InFlight+status[1].InFlight != 1 {
+		t.Errorf("Expected [1] request in flight, but got [%+v]", status)
+	}
+
+	names := balancedNames(t, f, context.Background(), 3)
+	first := open.String()
+	for _, name := range names {
+		if name == first {
+			t.Errorf("Expected requests sent to the other endpoint than [%s], but got [%s]", first, strings.Join(names, ","))
+		}
+	}
+	if status := lb.Status(); status[0].InFlight+status[1].InFlight != 0 {
+		t.Errorf("Expected none request in flight, but got [%+v]", status)
+	}
+}
+
+func TestLoadBalancerOptions_Ejection(t *testing.T) {
+	servers, endpoints := replicasMock("fail", "ok")
+	defer closeServers(servers)
+
+	lb := &LoadBalancerOptions{Endpoints: endpoints, MaxFailures: 2}
+	opt := DefaultOptions()
+	opt.LoadBalancer = lb
+
+	names := balancedNames(t, New(opt), context.Background(), 6)
+	if output := strings.Join(names, ","); output != "fail,ok,fail,ok,ok,ok" {
+		t.Errorf("Expected [fail,ok,fail,ok,ok,ok], but got [%s]", output)
+	}
+	if status := lb.Status(); status[0].EjectedUntil.IsZero() || !status[1].EjectedUntil.IsZero() {
+		t.Errorf("Expected first endpoint ejected, but got [%+v]", status)
+	}
+}
+
+func TestLoadBalancerOptions_Retry(t *testing.T) {
+	servers, endpoints := replicasMock("ok")
+	defer closeServers(servers)
+
+	tests := []struct {
+		desc    string
+		method  string
+		retries int
+		output  string
+	}{
+		{desc: "Get", method: http.MethodGet, output: "ok"},
+		{desc: "PostDialError", method: http.MethodPost, output: "ok"},
+		{desc: "Disabled", method: http.MethodGet, retries: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			metrics := &Metrics{}
+			opt := DefaultOptions()
+			opt.Metrics = metrics
+			opt.LoadBalancer = &LoadBalancerOptions{
+				Endpoints: []Endpoint{{URL: "http://127.0.0.1:1"}, endpoints[0]},
+				Retries:   test.retries,
+			}
+
+			req, _ := NewRequest(test.method, "/name", strings.NewReader("body"))
+			rsp, err := New(opt).Do(req)
+			if test.output == "" {
+				if err == nil {
+					t.Error("Expected connection error, but got none error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+
+			var out strings.Builder
+			_, _ = metrics.WriteTo(&out)
+			if line := "_retries_total{method=\"" + test.method + "\",host=\"\",route=\"other\"} 1"; !strings.Contains(out.String(), line) {
+				t.Errorf("Expected [%s], but got [%s]", line, out.String())
+			}
+		})
+	}
+
+	opt := DefaultOptions()
+	opt.LoadBalancer = &LoadBalancerOptions{Endpoints: []Endpoint{{URL: "localhost"}}}
+	if _, err := New(opt).Get("/name", nil); err == nil || !strings.Contains(err.Error(), "invalid endpoint") {
+		t.Errorf("Expected invalid endpoint error, but got [%v]", err)
+	}
+}
+
+func TestLoadBalancerOptions_WebSocket(t *testing.T) {
+	s := serverHandlerMock(websocketServer(echo))
+	defer s.Close()
+
+	balancer := &LoadBalancerOptions{Endpoints: []Endpoint{{URL: s.URL}}}
+	opt := DefaultOptions()
+	opt.LoadBalancer = balancer
+
+	ws, err := New(opt).WebSocket(context.Background(), "/ws")
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	defer ws.Close(CloseNormal, "")
+
+	if status := balancer.Status(); status[0].InFlight != 0 {
+		t.Errorf("Expected upgraded request released, but got [%d] in flight", status[0].InFlight)
+	}
+	if err := ws.WriteMessage(TextMessage, []byte("balanced")); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "balanced" {
+		t.Errorf("Expected [balanced], but got [%s] [%v]", data, err)
+	}
+}
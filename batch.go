@@ -0,0 +1,212 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// DefaultBatchConcurrency is the number of requests sent at once by DoAll when
+// the concurrency isn't positive.
+const DefaultBatchConcurrency = 10
+
+// ErrBatchAborted is the error of requests not sent because another
+// request failed with BatchOptions.FailFast.
+var ErrBatchAborted = errors.New("batch aborted by a failed request")
+
+// BatchOptions configure DoAllWithOptions.
+type BatchOptions struct {
+	// Concurrency is the number of requests sent at once, DefaultBatchConcurrency
+	// when not positive.
+	Concurrency int
+	// FailFast cancels the requests in flight and skips the others after the
+	// first error.
+	FailFast bool
+	// Progress is called after each request, one call at a time.
+	Progress func(done, total int)
+}
+
+// BatchError collects the errors of the requests of a batch.
+type BatchError struct {
+	// Errors has the error of each request, in the order of requests,
+	// nil for the requests succeeded.
+	Errors []error
+}
+
+// Failed returns the number of requests failed.
+func (e *BatchError) Failed() int {
+	n := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func (e *BatchError) Error() string {
+	for i, err := range e.Errors {
+		if err != nil {
+			return fmt.Sprintf("%d of %d requests failed, request %d: %s", e.Failed(), len(e.Errors), i, err)
+		}
+	}
+	return "none request failed"
+}
+
+// StatusError is returned by the helpers decoding responses when the
+// status isn't 2xx.
+type StatusError struct {
+	Response *Response
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", e.Response.Status)
+}
+
+// checkStatus returns a StatusError when the status of rsp isn't 2xx, the body
+// is read, so the error keeps it, and closed to release the connection
+func checkStatus(rsp *Response) error {
+	if rsp.StatusCode >= http.StatusOK && rsp.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+
+	if rsp.Body != nil {
+		_, _ = rsp.Bytes()
+		_ = rsp.Body.Close()
+	}
+	return &StatusError{Response: rsp}
+}
+
+// DoAll sends reqs with DoWithContext, concurrency at a time, and returns the
+// responses in the order of reqs. The error is a *BatchError when a request fails,
+// the responses of the other requests are still returned. The bodies can be read
+// after DoAll returns and should be closed.
+func (f *Fetch) DoAll(ctx context.Context, reqs []*http.Request, concurrency int) ([]*Response, error) {
+	return f.DoAllWithOptions(ctx, reqs, BatchOptions{Concurrency: concurrency})
+}
+
+// DoAllWithOptions works as DoAll with the fail fast and progress of opt.
+func (f *Fetch) DoAllWithOptions(ctx context.Context, reqs []*http.Request, opt BatchOptions) ([]*Response, error) {
+	responses := make([]*Response, len(reqs))
+	err := f.doAll(ctx, reqs, opt, func(i int, rsp *Response) error {
+		responses[i] = rsp
+		return nil
+	})
+	return responses, err
+}
+
+// doAll sends reqs with a pool of workers and calls handle with each response,
+// the errors of requests and handle are collected in a *BatchError
+func (f *Fetch) doAll(ctx context.Context, reqs []*http.Request, opt BatchOptions, handle func(i int, rsp *Response) error) error {
+	concurrency := opt.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+	if concurrency > len(reqs) {
+		concurrency = len(reqs)
+	}
+
+	var (
+		mu       sync.Mutex
+		done     int
+		aborted  bool
+		errs     = make([]error, len(reqs))
+		failed   bool
+		inFlight = map[int]context.CancelFunc{}
+	)
+	finish := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[i], failed = err, true
+			if opt.FailFast && !aborted {
+				aborted = true
+				for _, cancel := range inFlight {
+					cancel()
+				}
+			}
+		}
+		done++
+		if opt.Progress != nil {
+			opt.Progress(done, len(reqs))
+		}
+	}
+	// start returns the context of request i, each request has its own so the
+	// responses returned outlive the batch, false when the batch is aborted
+	start := func(i int) (context.Context, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if aborted {
+			return nil, false
+		}
+		reqCtx, cancel := context.WithCancel(ctx)
+		inFlight[i] = cancel
+		return reqCtx, true
+	}
+	// received returns the cancel of request i, FailFast doesn't cancel it anymore
+	received := func(i int) context.CancelFunc {
+		mu.Lock()
+		defer mu.Unlock()
+		cancel := inFlight[i]
+		delete(inFlight, i)
+		return cancel
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				reqCtx, ok := start(i)
+				if !ok {
+					finish(i, ErrBatchAborted)
+					continue
+				}
+
+				rsp, err := f.DoWithContext(reqCtx, reqs[i])
+				cancel := received(i)
+				if err != nil || rsp.Body == nil {
+					cancel()
+				} else {
+					// the context is canceled when the body is closed
+					rsp.Body = &cancelBody{ReadCloser: rsp.Body, cancel: cancel}
+				}
+				if err == nil {
+					err = handle(i, rsp)
+				}
+				finish(i, err)
+			}
+		}()
+	}
+
+	for i := range reqs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if failed {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// DoAllJSON sends reqs as DoAllWithOptions and decodes the JSON body of each
+// response into T, in the order of reqs. Responses without 2xx status fail with
+// a *StatusError and count as failed for FailFast.
+func DoAllJSON[T any](ctx context.Context, f *Fetch, reqs []*http.Request, opt BatchOptions) ([]T, error) {
+	values := make([]T, len(reqs))
+	err := f.doAll(ctx, reqs, opt, func(i int, rsp *Response) error {
+		if err := checkStatus(rsp); err != nil {
+			return err
+		}
+		err := rsp.Decode(&values[i])
+		_ = rsp.Body.Close()
+		return err
+	})
+	return values, err
+}
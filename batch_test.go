@@ -0,0 +1,224 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFetch_DoAll(t *testing.T) {
+	var current, max int32
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		defer atomic.AddInt32(&current, -1)
+		for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+		}
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, r.URL.Path)
+	})
+	defer s.Close()
+
+	reqs := make([]*http.Request, 30)
+	for i := range reqs {
+		url := fmt.Sprintf("%s/%d", s.URL, i)
+		if i%10 == 3 {
+			url = "http://127.0.0.1:1/unreachable"
+		}
+		reqs[i], _ = NewRequest(http.MethodGet, url, nil)
+	}
+
+	responses, err := NewDefault().DoAll(context.Background(), reqs, 4)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Failed() != 3 {
+		t.Fatalf("Expected [3] requests failed, but got [%v]", err)
+	}
+	for i, rsp := range responses {
+		if i%10 == 3 {
+			if rsp != nil || batchErr.Errors[i] == nil {
+				t.Errorf("Expected request [%d] failed, but got [%v]", i, batchErr.Errors[i])
+			}
+			continue
+		}
+		if output := rsp.String(); output != fmt.Sprintf("/%d", i) || batchErr.Errors[i] != nil {
+			t.Errorf("Expected [/%d], but got [%s]", i, output)
+		}
+	}
+	if m := atomic.LoadInt32(&max); m > 4 {
+		t.Errorf("Expected at most [4] requests at once, but got [%d]", m)
+	}
+}
+
+func TestFetch_DoAllWithOptions(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	})
+	defer s.Close()
+
+	reqs := make([]*http.Request, 10)
+	for i := range reqs {
+		reqs[i], _ = NewRequest(http.MethodGet, s.URL, nil)
+	}
+	reqs[0], _ = NewRequest(http.MethodGet, "http://127.0.0.1:1/unreachable", nil)
+
+	tests := []struct {
+		desc     string
+		failFast bool
+		aborted  int
+	}{
+		{desc: "FailFast", failFast: true, aborted: 9},
+		{desc: "All", failFast: false, aborted: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var progress []int
+			opt := BatchOptions{Concurrency: 1, FailFast: test.failFast, Progress: func(done, total int) {
+				if total != len(reqs) {
+					t.Errorf("Expected total [%d], but got [%d]", len(reqs), total)
+				}
+				progress = append(progress, done)
+			}}
+
+			_, err := NewDefault().DoAllWithOptions(context.Background(), reqs, opt)
+			var batchErr *BatchError
+			if !errors.As(err, &batchErr) {
+				t.Fatalf("Expected batch error, but got [%v]", err)
+			}
+			aborted := 0
+			for _, err := range batchErr.Errors {
+				if err == ErrBatchAborted {
+					aborted++
+				}
+			}
+			if aborted != test.aborted || batchErr.Failed() != test.aborted+1 {
+				t.Errorf("Expected [%d] aborted, but got [%d] of [%d] failed", test.aborted, aborted, batchErr.Failed())
+			}
+			if len(progress) != len(reqs) || progress[len(progress)-1] != len(reqs) {
+				t.Errorf("Expected progress up to [%d], but got [%v]", len(reqs), progress)
+			}
+		})
+	}
+}
+
+func TestFetch_DoAllSlowBody(t *testing.T) {
+	chunk := strings.Repeat("x", 64*1024)
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			// fails once the response of the slow body is received
+			time.Sleep(100 * time.Millisecond)
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		for i := 0; i < 32; i++ {
+			fmt.Fprint(w, chunk)
+			w.(http.Flusher).Flush()
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	defer s.Close()
+
+	reqs := make([]*http.Request, 2)
+	reqs[0], _ = NewRequest(http.MethodGet, s.URL+"/slow", nil)
+	reqs[1], _ = NewRequest(http.MethodGet, s.URL+"/fail", nil)
+
+	responses, err := NewDefault().DoAllWithOptions(context.Background(), reqs, BatchOptions{Concurrency: 2, FailFast: true})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Errors[0] != nil || batchErr.Errors[1] == nil {
+		t.Fatalf("Expected second request failed, but got [%v]", err)
+	}
+
+	body, err := ioutil.ReadAll(responses[0].Body)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if len(body) != 32*len(chunk) {
+		t.Errorf("Expected body of [%d] bytes, but got [%d]", 32*len(chunk), len(body))
+	}
+	_ = responses[0].Body.Close()
+}
+
+func TestDoAllJSON(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/invalid":
+			fmt.Fprint(w, "{")
+		default:
+			fmt.Fprintf(w, `{"name":%q}`, r.URL.Path)
+		}
+	})
+	defer s.Close()
+
+	type item struct {
+		Name string `json:"name"`
+	}
+
+	paths := []string{"/a", "/missing", "/b", "/invalid"}
+	reqs := make([]*http.Request, len(paths))
+	for i, path := range paths {
+		reqs[i], _ = NewRequest(http.MethodGet, s.URL+path, nil)
+	}
+
+	items, err := DoAllJSON[item](context.Background(), NewDefault(), reqs, BatchOptions{Concurrency: 2})
+	if len(items) != len(paths) || items[0].Name != "/a" || items[2].Name != "/b" || items[1].Name != "" {
+		t.Errorf("Expected items in order, but got [%+v]", items)
+	}
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Failed() != 2 {
+		t.Fatalf("Expected [2] requests failed, but got [%v]", err)
+	}
+	var statusErr *StatusError
+	if !errors.As(batchErr.Errors[1], &statusErr) || statusErr.Response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status error [404], but got [%v]", batchErr.Errors[1])
+	}
+	if batchErr.Errors[3] == nil {
+		t.Error("Expected decode error, but got none error")
+	}
+}
+
+func TestDoAllJSON_StatusError(t *testing.T) {
+	var conns int32
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	s.Start()
+	defer s.Close()
+
+	reqs := make([]*http.Request, 5)
+	for i := range reqs {
+		reqs[i], _ = NewRequest(http.MethodGet, s.URL, nil)
+	}
+
+	_, err := DoAllJSON[struct{}](context.Background(), NewDefault(), reqs, BatchOptions{Concurrency: 1})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || batchErr.Failed() != len(reqs) {
+		t.Fatalf("Expected [%d] requests failed, but got [%v]", len(reqs), err)
+	}
+
+	var statusErr *StatusError
+	if !errors.As(batchErr.Errors[0], &statusErr) || statusErr.Response.String() != `{"error":"not found"}` {
+		t.Errorf("Expected body kept in status error, but got [%v]", batchErr.Errors[0])
+	}
+	// bodies are closed, so the connection is reused
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("Expected [1] connection, but got [%d]", n)
+	}
+}
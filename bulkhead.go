@@ -0,0 +1,179 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBulkheadFull is returned when the requests in flight reach the limits of
+// BulkheadOptions and the queue is full.
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// BulkheadOptions limit the requests in flight, so a slow dependency can't hold
+// every goroutine. Requests beyond the limits wait in a queue, in order, until a
+// request ends or their context is done. A request is in flight until its
+// response body is read entirely or closed, so bodies must be closed as with
+// net/http. The options keep the requests in flight, share them between clients
+// to limit them together.
+type BulkheadOptions struct {
+	// Total is the maximum of requests in flight, unlimited when zero.
+	Total int
+	// PerHost is the maximum of requests in flight to each host, unlimited when zero.
+	PerHost int
+	// MaxQueue is the maximum of requests waiting, requests are rejected with
+	// ErrBulkheadFull instead of waiting when zero.
+	MaxQueue int
+
+	mu       sync.Mutex
+	inFlight int
+	hosts    map[string]int
+	queue    []*bulkheadWaiter
+}
+
+// bulkheadWaiter is a request waiting in the queue
+type bulkheadWaiter struct {
+	host  string
+	ready chan struct{}
+}
+
+// Timings are the durations of the steps of a request.
+type Timings struct {
+	// QueueWait is the time waiting in the queue of Options.MaxInFlight,
+	// summed for requests sent several times.
+	QueueWait time.Duration
+	// Headers is the time until the response headers are received,
+	// queue wait included.
+	Headers time.Duration
+}
+
+// Timings returns the durations of the steps of request.
+func (r *Response) Timings() Timings {
+	if r.info == nil {
+		return Timings{}
+	}
+	return Timings{
+		QueueWait: time.Duration(atomic.LoadInt64(&r.info.queueWait)),
+		Headers:   r.info.headers,
+	}
+}
+
+// available reports whether a request to host can start, the caller holds mu
+func (o *BulkheadOptions) available(host string) bool {
+	return (o.Total <= 0 || o.inFlight < o.Total) && (o.PerHost <= 0 || o.hosts[host] < o.PerHost)
+}
+
+// start counts a request to host in flight, the caller holds mu
+func (o *BulkheadOptions) start(host string) {
+	if o.hosts == nil {
+		o.hosts = map[string]int{}
+	}
+	o.inFlight++
+	o.hosts[host]++
+}
+
+// acquire waits until a request to host can start
+func (o *BulkheadOptions) acquire(req *http.Request) (func(), error) {
+	host := req.URL.Host
+	release := func() { o.release(host) }
+
+	o.mu.Lock()
+	// the requests waiting can't start, or they would have been started by dispatch
+	if o.available(host) {
+		o.start(host)
+		o.mu.Unlock()
+		return release, nil
+	}
+	if len(o.queue) >= o.MaxQueue {
+		o.mu.Unlock()
+		return nil, ErrBulkheadFull
+	}
+	w := &bulkheadWaiter{host: host, ready: make(chan struct{})}
+	o.queue = append(o.queue, w)
+	o.mu.Unlock()
+
+	start := time.Now()
+	defer func() {
+		if info := infoFromContext(req.Context()); info != nil {
+			atomic.AddInt64(&info.queueWait, int64(time.Since(start)))
+		}
+	}()
+
+	select {
+	case <-w.ready:
+		return release, nil
+	case <-req.Context().Done():
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	select {
+	case <-w.ready:
+		// started while the context was done
+		o.end(host)
+	default:
+		for i, queued := range o.queue {
+			if queued == w {
+				o.queue = append(o.queue[:i], o.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil, req.Context().Err()
+}
+
+// release ends a request to host
+func (o *BulkheadOptions) release(host string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.end(host)
+}
+
+// end ends a request to host and starts the requests waiting, the caller holds mu
+func (o *BulkheadOptions) end(host string) {
+	o.inFlight--
+	o.hosts[host]--
+	if o.hosts[host] == 0 {
+		delete(o.hosts, host)
+	}
+	o.dispatch()
+}
+
+// dispatch starts the requests waiting whose limits allow it, in order,
+// the caller holds mu
+func (o *BulkheadOptions) dispatch() {
+	queue := o.queue[:0]
+	for _, w := range o.queue {
+		if o.available(w.host) {
+			o.start(w.host)
+			close(w.ready)
+			continue
+		}
+		queue = append(queue, w)
+	}
+	for i := len(queue); i < len(o.queue); i++ {
+		o.queue[i] = nil
+	}
+	o.queue = queue
+}
+
+// limit returns send limiting the requests in flight
+func (o *BulkheadOptions) limit(send sendFunc) sendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		release, err := o.acquire(req)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := send(req)
+		// the body of switching protocols is the connection itself, not a request
+		if err != nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			release()
+			return resp, err
+		}
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	}
+}
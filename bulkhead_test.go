@@ -0,0 +1,177 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingMock starts a server holding the requests to /block until release is closed
+func blockingMock(started *int32, release <-chan struct{}) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/block" {
+			atomic.AddInt32(started, 1)
+			<-release
+		}
+		fmt.Fprint(w, "ok")
+	}
+}
+
+// waitStarted waits until n requests are held by blockingMock
+func waitStarted(t *testing.T, started *int32, n int32) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); atomic.LoadInt32(started) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected [%d] requests started, but got [%d]", n, atomic.LoadInt32(started))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadOptions_Reject(t *testing.T) {
+	tests := []struct {
+		desc     string
+		bulkhead *BulkheadOptions
+		other    string
+	}{
+		{desc: "Total", bulkhead: &BulkheadOptions{Total: 1}, other: "bulkhead full"},
+		{desc: "PerHost", bulkhead: &BulkheadOptions{PerHost: 1}, other: "ok"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var started int32
+			release := make(chan struct{})
+			a := serverHandlerMock(blockingMock(&started, release))
+			defer a.Close()
+			b := serverHandlerMock(blockingMock(&started, release))
+			defer b.Close()
+
+			opt := DefaultOptions()
+			opt.MaxInFlight = test.bulkhead
+			f := New(opt)
+
+			done := make(chan string)
+			go func() {
+				rsp, _ := f.Get(a.URL+"/block", nil)
+				done <- rsp.String()
+			}()
+			waitStarted(t, &started, 1)
+
+			if _, err := f.Get(a.URL, nil); !errors.Is(err, ErrBulkheadFull) {
+				t.Errorf("Expected [%s], but got [%v]", ErrBulkheadFull, err)
+			}
+			rsp, err := f.Get(b.URL, nil)
+			if output := rsp.String(); err != nil && err.Error() != test.other || err == nil && output != test.other {
+				t.Errorf("Expected [%s] from other host, but got [%s] [%v]", test.other, output, err)
+			}
+
+			close(release)
+			if output := <-done; output != "ok" {
+				t.Errorf("Expected [ok], but got [%s]", output)
+			}
+			if _, err := f.Get(a.URL, nil); err != nil {
+				t.Errorf("Expected none error after release, but got [%s]", err)
+			}
+		})
+	}
+}
+
+func TestBulkheadOptions_Queue(t *testing.T) {
+	var started int32
+	release := make(chan struct{})
+	s := serverHandlerMock(blockingMock(&started, release))
+	defer s.Close()
+
+	bulkhead := &BulkheadOptions{Total: 1, MaxQueue: 1}
+	opt := DefaultOptions()
+	opt.MaxInFlight = bulkhead
+	f := New(opt)
+
+	go func() {
+		if rsp, err := f.Get(s.URL+"/block", nil); err == nil {
+			_ = rsp.Body.Close()
+		}
+	}()
+	waitStarted(t, &started, 1)
+
+	// the queue wait respects the context deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := f.GetWithContext(ctx, s.URL, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected [%s], but got [%v]", context.DeadlineExceeded, err)
+	}
+
+	queued := make(chan *Response)
+	go func() {
+		rsp, _ := f.Get(s.URL, nil)
+		queued <- rsp
+	}()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		bulkhead.mu.Lock()
+		n := len(bulkhead.queue)
+		bulkhead.mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	if _, err := f.Get(s.URL, nil); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected [%s] with queue full, but got [%v]", ErrBulkheadFull, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	rsp := <-queued
+	if output := rsp.String(); output != "ok" {
+		t.Errorf("Expected [ok], but got [%s]", output)
+	}
+	if timings := rsp.Timings(); timings.QueueWait < 50*time.Millisecond || timings.Headers < timings.QueueWait {
+		t.Errorf("Expected queue wait above [50ms], but got [%+v]", timings)
+	}
+}
+
+func TestBulkheadOptions_Body(t *testing.T) {
+	release := make(chan struct{})
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stream" {
+			fmt.Fprint(w, "first ")
+			w.(http.Flusher).Flush()
+			<-release
+		}
+		fmt.Fprint(w, "ok")
+	})
+	defer s.Close()
+	defer close(release)
+
+	opt := DefaultOptions()
+	opt.MaxInFlight = &BulkheadOptions{Total: 1}
+	f := New(opt)
+
+	// the slot is held while the body streams, after the headers
+	stream, err := f.Get(s.URL+"/stream", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if _, err := f.Get(s.URL, nil); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("Expected [%s] while the body streams, but got [%v]", ErrBulkheadFull, err)
+	}
+
+	_ = stream.Body.Close()
+	rsp, err := f.Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error after close, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "ok" {
+		t.Errorf("Expected [ok], but got [%s]", output)
+	}
+
+	// reading the body entirely releases the slot too
+	if _, err := f.Get(s.URL, nil); err != nil {
+		t.Errorf("Expected none error after read, but got [%s]", err)
+	}
+}
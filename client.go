@@ -2,9 +2,13 @@ package fetch
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/net/context/ctxhttp"
@@ -19,6 +23,72 @@ type Options struct {
 	Timeout   time.Duration
 	Host      string
 	Transport *http.Transport
+
+	// Auth is applied to every request right before it is sent,
+	// so credentials never live in the shared Header.
+	Auth Authenticator
+
+	// CookieJar stores the cookies between requests, NewJar is used when nil.
+	CookieJar http.CookieJar
+
+	// Redirect controls how redirects are followed, the http.Client default is used when nil.
+	Redirect *RedirectPolicy
+
+	// TLS configure the transport created by New, it's ignored when Transport is set.
+	TLS *TLSOptions
+
+	// Proxy configure the proxy of transport created by New, none proxy is used when nil.
+	Proxy *ProxyOptions
+
+	// Resolver configure how the transport created by New resolves hosts, the system resolver is used when nil.
+	Resolver *ResolverOptions
+
+	// Dial overrides how the transport created by New opens connections, Resolver is ignored when set.
+	// Requests with UnixScheme URLs always use Unix domain sockets.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Protocol selects the HTTP version of transport created by New, HTTP/2 is preferred by default.
+	Protocol Protocol
+	// HTTP2 configure the health check of HTTP/2 connections.
+	HTTP2 *HTTP2Options
+
+	// WebSocket configure the connections opened by Fetch.WebSocket.
+	WebSocket *WebSocketOptions
+
+	// Download configure the parallel ranges and the progress of Fetch.Download.
+	Download *DownloadOptions
+
+	// Progress reports the transfer of request and response bodies, see WithProgress to set it per request.
+	Progress *ProgressOptions
+
+	// Compression compresses request bodies and decodes response bodies, even when
+	// Accept-Encoding is set in request. When nil, gzip is asked and decoded as
+	// http.Transport does, so bodies are kept as received when Accept-Encoding is
+	// set in request.
+	Compression *CompressionOptions
+
+	// Metrics collects the metrics of requests, it can be shared by several clients.
+	Metrics *Metrics
+
+	// Tracer starts a client span for every request. The trace context of the request
+	// context, see ContextWithSpanContext, is propagated in traceparent even when nil.
+	Tracer Tracer
+
+	// Hedge sends duplicates of slow GET and HEAD requests and uses the first response.
+	Hedge *HedgeOptions
+
+	// LoadBalancer sends the requests to its endpoints instead of the host of request URL.
+	LoadBalancer *LoadBalancerOptions
+
+	// HealthCheck probes the endpoints of LoadBalancer in background, see Fetch.Close.
+	HealthCheck *HealthCheckOptions
+
+	// SingleFlight sends concurrent identical GET and HEAD requests once.
+	SingleFlight *SingleFlightOptions
+
+	// MaxInFlight limits the requests in flight, globally and per host. Requests beyond
+	// the limits are queued or rejected with ErrBulkheadFull, see Response.Timings.
+	MaxInFlight *BulkheadOptions
 }
 
 // DefaultOptions returns options with timeout defined
@@ -35,17 +105,60 @@ func NewDefault() *Fetch {
 }
 
 // getTransport make transport from options definitions
-func getTransport(opt *Options) {
+func getTransport(opt *Options) error {
 	if opt.Timeout.Nanoseconds() == 0 {
 		opt.Timeout = DefaultTimeout
 	}
 
-	opt.Transport = &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout: opt.Timeout,
-		}).DialContext,
+	dialer := &net.Dialer{
+		Timeout: opt.Timeout,
+	}
+
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
 		TLSHandshakeTimeout: opt.Timeout,
 	}
+
+	if opt.Resolver != nil {
+		resolving, err := newResolvingDialer(opt.Resolver, dialer)
+		if err != nil {
+			return err
+		}
+		transport.DialContext = resolving.DialContext
+	}
+
+	if opt.Dial != nil {
+		transport.DialContext = opt.Dial
+	}
+	transport.RegisterProtocol(UnixScheme, newUnixTransport(dialer))
+
+	if opt.TLS != nil {
+		cfg, err := opt.TLS.Config()
+		if err != nil {
+			return err
+		}
+		transport.TLSClientConfig = cfg
+	}
+
+	if opt.Proxy != nil {
+		// h2c requests are sent by their own transport, which doesn't use the proxy
+		if opt.Protocol == ProtocolH2C {
+			return errors.New("h2c protocol can't be used with a proxy")
+		}
+		proxy, err := opt.Proxy.proxyFunc()
+		if err != nil {
+			return err
+		}
+		transport.Proxy = proxy
+	}
+
+	// HTTP/2 is configured last because it changes TLSClientConfig
+	if _, err := configureProtocol(transport, opt.Protocol, opt.HTTP2); err != nil {
+		return err
+	}
+
+	opt.Transport = transport
+	return nil
 }
 
 // New get new fetcher and you need to specify the netTransport.
@@ -54,23 +167,55 @@ func New(opt *Options) *Fetch {
 		opt = DefaultOptions()
 	}
 
+	var err error
 	if opt.Transport == nil {
-		getTransport(opt)
+		err = getTransport(opt)
 	}
 
-	return &Fetch{
-		Client: &http.Client{
-			Timeout:   opt.Timeout,
-			Transport: opt.Transport,
-		},
-		Option: opt,
+	if err == nil && opt.LoadBalancer != nil {
+		err = opt.LoadBalancer.init()
 	}
+
+	if opt.CookieJar == nil {
+		opt.CookieJar = NewJar()
+	}
+
+	client := &http.Client{
+		Timeout:   opt.Timeout,
+		Transport: opt.Transport,
+		Jar:       opt.CookieJar,
+	}
+
+	if opt.Redirect != nil {
+		client.CheckRedirect = opt.Redirect.checkRedirect
+	}
+
+	f := &Fetch{
+		Client:    client,
+		Option:    opt,
+		websocket: websocketTransport(opt.Transport, opt.Timeout),
+	}
+
+	if err == nil && opt.HealthCheck != nil {
+		// probes use the transport without cookies and redirects of requests
+		f.health, err = startHealthChecker(opt.HealthCheck, opt.LoadBalancer, &http.Client{Transport: opt.Transport}, opt.Auth)
+	}
+	f.err = err
+
+	return f
 }
 
 // Fetch use http default but defined with a timeout.
 type Fetch struct {
 	*http.Client
 	Option *Options
+
+	// err keep the configuration error returned by every request
+	err error
+	// health runs the health checks until Close
+	health *healthChecker
+	// websocket is the transport of WebSocket handshakes, HTTP/1.1 only
+	websocket *http.Transport
 }
 
 // IsJSON add Content-Type as JSON in header.
@@ -95,18 +240,154 @@ func (f Fetch) makeResponse(resp *http.Response, err error) (*Response, error) {
 	return &Response{Response: resp}, err
 }
 
-// Do execute any kind of request
-func (f *Fetch) Do(req *http.Request) (*Response, error) {
+// prepareRequest copy the default headers into request, compress the body
+// and apply the authenticator, so signatures cover the compressed body
+func (f *Fetch) prepareRequest(req *http.Request) error {
+	// the headers of caller's request are not changed
+	header := http.Header{}
 	if f.Option.Header != nil {
-		req.Header = f.Option.Header
+		header = f.Option.Header.Clone()
+	}
+	for k, v := range req.Header {
+		header[k] = v
+	}
+	req.Header = header
+
+	if f.Option.Compression != nil {
+		f.Option.Compression.acceptEncoding(req)
+		if err := f.Option.Compression.compressRequest(req); err != nil {
+			return fmt.Errorf("couldn't compress request: %s", err)
+		}
+	} else if info := infoFromContext(req.Context()); info != nil && !f.compressionDisabled() {
+		// gzip is decoded by decodeResponse instead of http.Transport to count the wire size
+		info.askedGzip = askGzip(req)
+	}
+
+	if f.Option.Auth != nil {
+		if err := f.Option.Auth.Authenticate(req); err != nil {
+			return fmt.Errorf("couldn't authenticate request: %s", err)
+		}
 	}
 
-	return f.makeResponse(f.Client.Do(req))
+	return nil
+}
+
+// compressionDisabled reports whether the transport of Options doesn't ask for gzip
+func (f *Fetch) compressionDisabled() bool {
+	return f.Option.Transport != nil && f.Option.Transport.DisableCompression
+}
+
+// sendFunc sends a prepared request and returns the raw response
+type sendFunc func(req *http.Request) (*http.Response, error)
+
+// do prepare the request, send it and answer authentication challenges
+func (f *Fetch) do(req *http.Request, send sendFunc) (*Response, error) {
+	if f.err != nil {
+		return newErrorResponse(http.StatusNoContent, "couldn't configure client: %s", f.err)
+	}
+
+	start := time.Now()
+	req, info := withRequestInfo(req)
+	req, span := f.startSpan(req)
+	if err := f.prepareRequest(req); err != nil {
+		endSpan(span, nil, err)
+		return newErrorResponse(http.StatusNoContent, "%s", err)
+	}
+
+	progress := f.progressOptions(req.Context())
+	progress.trackUpload(req)
+
+	// limits are applied to the host of each request sent, after balancing
+	if f.Option.MaxInFlight != nil {
+		send = f.Option.MaxInFlight.limit(send)
+	}
+	// hedges are balanced as any other request
+	if f.Option.LoadBalancer != nil {
+		send = f.Option.LoadBalancer.balance(send)
+	}
+	if f.Option.Hedge != nil {
+		send = f.Option.Hedge.hedge(send)
+	}
+	if f.Option.SingleFlight != nil {
+		send = f.Option.SingleFlight.dedupe(send)
+	}
+
+	var observe func(*http.Response, error, *requestInfo)
+	if f.Option.Metrics != nil {
+		observe = f.Option.Metrics.begin(req)
+	}
+
+	resp, err := send(req)
+	if err == nil {
+		resp, err = f.answerChallenge(req, resp, send)
+	}
+	info.headers = time.Since(start)
+	if observe != nil {
+		observe(resp, err, info)
+	}
+	endSpan(span, resp, err)
+	if err == nil {
+		progress.trackDownload(resp)
+		decodeResponse(resp, info, f.Option.Compression != nil || info.askedGzip)
+	}
+
+	rsp, err := f.makeResponse(resp, err)
+	rsp.info = info
+	return rsp, err
+}
+
+// answerChallenge replay the request once when the authenticator
+// accepts the challenge of a 401 response.
+func (f *Fetch) answerChallenge(req *http.Request, resp *http.Response, send sendFunc) (*http.Response, error) {
+	responder, ok := f.Option.Auth.(ChallengeResponder)
+	if !ok || resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	// body already consumed and can't be rewound
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	retry, err := responder.Challenge(req, resp)
+	if err != nil || !retry {
+		return resp, err
+	}
+
+	replay := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if replay.Body, err = req.GetBody(); err != nil {
+			return resp, err
+		}
+	}
+	if err := responder.Authenticate(replay); err != nil {
+		return resp, err
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	if info := infoFromContext(req.Context()); info != nil {
+		atomic.AddInt64(&info.retries, 1)
+	}
+	return send(replay)
+}
+
+// streamClient returns a copy of Client without timeout for bodies read longer than Options.Timeout
+func (f *Fetch) streamClient() *http.Client {
+	client := *f.Client
+	client.Timeout = 0
+	return &client
+}
+
+// Do execute any kind of request
+func (f *Fetch) Do(req *http.Request) (*Response, error) {
+	return f.do(req, f.Client.Do)
 }
 
 // Get do request with HTTP using HTTP Verb GET
 func (f *Fetch) Get(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, reader)
+	req, err := NewRequest(http.MethodGet, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request GET: %s", err)
 	}
@@ -116,7 +397,7 @@ func (f *Fetch) Get(url string, reader io.Reader) (*Response, error) {
 
 // Post do request with HTTP using HTTP Verb POST
 func (f *Fetch) Post(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, reader)
+	req, err := NewRequest(http.MethodPost, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request POST: %s", err)
 	}
@@ -126,7 +407,7 @@ func (f *Fetch) Post(url string, reader io.Reader) (*Response, error) {
 
 // Put do request with HTTP using HTTP Verb PUT
 func (f *Fetch) Put(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPut, url, reader)
+	req, err := NewRequest(http.MethodPut, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request PUT: %s", err)
 	}
@@ -136,7 +417,7 @@ func (f *Fetch) Put(url string, reader io.Reader) (*Response, error) {
 
 // Delete do request with HTTP using HTTP Verb DELETE
 func (f *Fetch) Delete(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodDelete, url, reader)
+	req, err := NewRequest(http.MethodDelete, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request DELETE: %s", err)
 	}
@@ -145,7 +426,7 @@ func (f *Fetch) Delete(url string, reader io.Reader) (*Response, error) {
 
 // Patch do request with HTTP using HTTP Verb PATCH
 func (f *Fetch) Patch(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPatch, url, reader)
+	req, err := NewRequest(http.MethodPatch, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request PATCH: %s", err)
 	}
@@ -154,7 +435,7 @@ func (f *Fetch) Patch(url string, reader io.Reader) (*Response, error) {
 
 // Options do request with HTTP using HTTP Verb OPTIONS
 func (f *Fetch) Options(url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodOptions, url, reader)
+	req, err := NewRequest(http.MethodOptions, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request OPTIONS: %s", err)
 	}
@@ -163,16 +444,14 @@ func (f *Fetch) Options(url string, reader io.Reader) (*Response, error) {
 
 // DoWithContext execute any kind of request passing context
 func (f *Fetch) DoWithContext(ctx context.Context, req *http.Request) (*Response, error) {
-	if f.Option.Header != nil {
-		req.Header = f.Option.Header
-	}
-
-	return f.makeResponse(ctxhttp.Do(ctx, f.Client, req))
+	return f.do(req.WithContext(ctx), func(req *http.Request) (*http.Response, error) {
+		return ctxhttp.Do(req.Context(), f.Client, req)
+	})
 }
 
 // GetWithContext execute DoWithContext but define request to method GET
 func (f *Fetch) GetWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodGet, url, reader)
+	req, err := NewRequest(http.MethodGet, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request GET: %s", err)
 	}
@@ -182,7 +461,7 @@ func (f *Fetch) GetWithContext(ctx context.Context, url string, reader io.Reader
 
 // PostWithContext execute DoWithContext but define request to method POST
 func (f *Fetch) PostWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPost, url, reader)
+	req, err := NewRequest(http.MethodPost, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request POST: %s", err)
 	}
@@ -192,7 +471,7 @@ func (f *Fetch) PostWithContext(ctx context.Context, url string, reader io.Reade
 
 // PutWithContext execute DoWithContext but define request to method PUT
 func (f *Fetch) PutWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPut, url, reader)
+	req, err := NewRequest(http.MethodPut, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request PUT: %s", err)
 	}
@@ -201,7 +480,7 @@ func (f *Fetch) PutWithContext(ctx context.Context, url string, reader io.Reader
 
 // DeleteWithContext execute DoWithContext but define request to method DELETE
 func (f *Fetch) DeleteWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodDelete, url, reader)
+	req, err := NewRequest(http.MethodDelete, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request DELETE: %s", err)
 	}
@@ -211,7 +490,7 @@ func (f *Fetch) DeleteWithContext(ctx context.Context, url string, reader io.Rea
 
 // PatchWithContext execute DoWithContext but define request to method PATCH
 func (f *Fetch) PatchWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodPatch, url, reader)
+	req, err := NewRequest(http.MethodPatch, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request PATCH: %s", err)
 	}
@@ -220,7 +499,7 @@ func (f *Fetch) PatchWithContext(ctx context.Context, url string, reader io.Read
 
 // OptionsWithContext execute DoWithContext but define request to method OPTIONS
 func (f *Fetch) OptionsWithContext(ctx context.Context, url string, reader io.Reader) (*Response, error) {
-	req, err := http.NewRequest(http.MethodOptions, url, reader)
+	req, err := NewRequest(http.MethodOptions, url, reader)
 	if err != nil {
 		return newErrorResponse(http.StatusNoContent, "couldn't request OPTIONS: %s", err)
 	}
@@ -0,0 +1,219 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultCompressionMinSize is the smallest request body compressed.
+const DefaultCompressionMinSize = 1024
+
+// Content encodings supported by CompressionOptions.
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// CompressionOptions configure the compression of request bodies and
+// the decoding of response bodies.
+type CompressionOptions struct {
+	// Request is the encoding of request bodies, EncodingGzip or EncodingDeflate.
+	// Request bodies are not compressed when empty.
+	Request string
+	// MinSize is the smallest request body compressed, DefaultCompressionMinSize when zero.
+	// Bodies of unknown size are not compressed.
+	MinSize int64
+	// Level is the compression level of compress/flate, flate.DefaultCompression when zero.
+	Level int
+}
+
+// compressRequest compresses the body of req when it's large enough and
+// the compressed body is smaller
+func (o *CompressionOptions) compressRequest(req *http.Request) error {
+	minSize := o.MinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	if o.Request == "" || req.Body == nil || req.Body == http.NoBody ||
+		req.ContentLength < minSize || req.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	level := o.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch o.Request {
+	case EncodingGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case EncodingDeflate:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	default:
+		err = fmt.Errorf("unsupported encoding %s", o.Request)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if buf.Len() < len(body) {
+		body = buf.Bytes()
+		req.Header.Set("Content-Encoding", o.Request)
+	}
+
+	req.ContentLength = int64(len(body))
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return nil
+}
+
+// acceptEncoding asks for the encodings decoded by decodeResponse, the
+// Accept-Encoding set in request is kept and ranges are requested as is
+func (o *CompressionOptions) acceptEncoding(req *http.Request) {
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		req.Header.Set("Accept-Encoding", EncodingGzip+", "+EncodingDeflate)
+	}
+}
+
+// askGzip asks for gzip when Accept-Encoding isn't set, as http.Transport
+// does, so the body is counted before it's decoded by decodeResponse
+func askGzip(req *http.Request) bool {
+	if req.Method == http.MethodHead || req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return false
+	}
+	req.Header.Set("Accept-Encoding", EncodingGzip)
+	return true
+}
+
+// decodeResponse counts the bytes of body received and decoded, the
+// body is decoded when decode is true and the encoding is supported
+func decodeResponse(resp *http.Response, info *requestInfo, decode bool) {
+	// the body of switching protocols is the connection itself
+	if resp == nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		return
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if resp.Uncompressed {
+		// decoded by a custom transport, the size before decoding is unknown
+		encoding = EncodingGzip
+	}
+
+	info.mu.Lock()
+	info.encoding = encoding
+	info.mu.Unlock()
+
+	var body io.ReadCloser = &countingBody{ReadCloser: resp.Body, n: &info.wireSize}
+	if decode && !resp.Uncompressed && (encoding == EncodingGzip || encoding == EncodingDeflate) {
+		body = &decodingBody{ReadCloser: body, encoding: encoding}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = &countingBody{ReadCloser: body, n: &info.decodedSize}
+}
+
+// countingBody adds the bytes read to n
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	atomic.AddInt64(b.n, int64(n))
+	return n, err
+}
+
+// decodingBody decodes ReadCloser, the decoder is created on the first read
+// because it reads the header of encoding
+type decodingBody struct {
+	io.ReadCloser
+	encoding string
+	decoder  io.Reader
+	err      error
+}
+
+func (b *decodingBody) Read(p []byte) (int, error) {
+	if b.decoder == nil && b.err == nil {
+		b.decoder, b.err = newDecoder(b.ReadCloser, b.encoding)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.decoder.Read(p)
+}
+
+// newDecoder returns the decoder of encoding, deflate accepts the zlib
+// format of RFC 7230 and the raw deflate sent by some servers
+func newDecoder(r io.Reader, encoding string) (io.Reader, error) {
+	if encoding == EncodingGzip {
+		return gzip.NewReader(r)
+	}
+
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// Encoding returns the Content-Encoding of response as received from server.
+func (r *Response) Encoding() string {
+	if r.info == nil {
+		return ""
+	}
+
+	r.info.mu.Lock()
+	defer r.info.mu.Unlock()
+	return r.info.encoding
+}
+
+// WireSize returns the bytes of body read from the connection, before decoding.
+// It's the DecodedSize when the body was decoded by a custom Options.Transport.
+func (r *Response) WireSize() int64 {
+	if r.info == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.info.wireSize)
+}
+
+// DecodedSize returns the bytes of body read after decoding.
+func (r *Response) DecodedSize() int64 {
+	if r.info == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&r.info.decodedSize)
+}
@@ -0,0 +1,167 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCompressionOptions_Request(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		switch r.Header.Get("Content-Encoding") {
+		case "gzip":
+			body, _ = gzip.NewReader(r.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(r.Body)
+		}
+		data, _ := ioutil.ReadAll(body)
+		fmt.Fprintf(w, "%s:%d:%d", r.Header.Get("Content-Encoding"), r.ContentLength, len(data))
+	})
+	defer s.Close()
+
+	large := strings.Repeat("compressible ", 1000)
+	tests := []struct {
+		desc     string
+		encoding string
+		body     string
+		output   string
+		signed   string
+	}{
+		{desc: "Gzip", encoding: EncodingGzip, body: large, output: "gzip:", signed: "gzip"},
+		{desc: "Deflate", encoding: EncodingDeflate, body: large, output: "deflate:", signed: "deflate"},
+		{desc: "Small", encoding: EncodingGzip, body: "small", output: ":5:5"},
+		{desc: "Disabled", body: large, output: ":13000:13000"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var signed string
+			opt := DefaultOptions()
+			opt.Compression = &CompressionOptions{Request: test.encoding}
+			opt.Auth = AuthenticatorFunc(func(req *http.Request) error {
+				signed = req.Header.Get("Content-Encoding")
+				return nil
+			})
+
+			rsp, err := New(opt).Post(s.URL, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			output := rsp.String()
+			if !strings.HasPrefix(output, test.output) || !strings.HasSuffix(output, fmt.Sprintf(":%d", len(test.body))) {
+				t.Errorf("Expected [%s...:%d], but got [%s]", test.output, len(test.body), output)
+			}
+			if signed != test.signed {
+				t.Errorf("Expected authenticator after compression [%s], but got [%s]", test.signed, signed)
+			}
+		})
+	}
+
+	opt := DefaultOptions()
+	opt.Compression = &CompressionOptions{Request: "br"}
+	if _, err := New(opt).Post(s.URL, strings.NewReader(large)); err == nil {
+		t.Error("Expected unsupported encoding error, but got none error")
+	}
+}
+
+func TestCompressionOptions_Response(t *testing.T) {
+	content := strings.Repeat("decoded ", 1000)
+
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		var cw io.WriteCloser
+		encoding := strings.TrimPrefix(r.URL.Path, "/")
+		switch encoding {
+		case "gzip":
+			cw = gzip.NewWriter(&buf)
+		case "deflate":
+			cw = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			cw, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+			encoding = "deflate"
+		}
+		_, _ = io.WriteString(cw, content)
+		_ = cw.Close()
+
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		w.Header().Set("Content-Encoding", encoding)
+		_, _ = w.Write(buf.Bytes())
+	})
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.Header.Set("Accept-Encoding", "gzip")
+	opt.Compression = &CompressionOptions{}
+	f := New(opt)
+
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		t.Run(fmt.Sprintf("Test-%s", encoding), func(t *testing.T) {
+			rsp, err := f.Get(s.URL+"/"+encoding, nil)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != content {
+				t.Errorf("Expected content decoded, but got [%.20s]", output)
+			}
+			if rsp.Header.Get("X-Accept-Encoding") != "gzip" {
+				t.Errorf("Expected Accept-Encoding kept, but got [%s]", rsp.Header.Get("X-Accept-Encoding"))
+			}
+			if !strings.HasSuffix(encoding, rsp.Encoding()) || rsp.Header.Get("Content-Encoding") != "" {
+				t.Errorf("Expected encoding [%s], but got [%s]", encoding, rsp.Encoding())
+			}
+			if rsp.DecodedSize() != int64(len(content)) || rsp.WireSize() >= rsp.DecodedSize() || rsp.WireSize() == 0 {
+				t.Errorf("Expected wire size smaller than [%d], but got [%d/%d]", len(content), rsp.WireSize(), rsp.DecodedSize())
+			}
+		})
+	}
+
+	// without Compression gzip is asked and decoded
+	rsp, err := NewDefault().Get(s.URL+"/gzip", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != content || rsp.Header.Get("X-Accept-Encoding") != "gzip" || rsp.Encoding() != "gzip" {
+		t.Errorf("Expected gzip decoded, but got [%s] [%.20s]", rsp.Encoding(), output)
+	}
+	if rsp.DecodedSize() != int64(len(content)) || rsp.WireSize() >= rsp.DecodedSize() || rsp.WireSize() == 0 {
+		t.Errorf("Expected wire size smaller than [%d], but got [%d/%d]", len(content), rsp.WireSize(), rsp.DecodedSize())
+	}
+
+	// the request of caller is not changed
+	opt = DefaultOptions()
+	opt.Header = nil
+	req, _ := NewRequest(http.MethodGet, s.URL+"/gzip", nil)
+	if _, err := New(opt).Do(req); err != nil || len(req.Header) != 0 {
+		t.Errorf("Expected request headers unchanged, but got [%v] [%v]", req.Header, err)
+	}
+
+	// the transport disabling compression doesn't ask for gzip
+	opt = DefaultOptions()
+	opt.Transport = &http.Transport{DisableCompression: true}
+	rsp, err = New(opt).Get(s.URL+"/gzip", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output == content || rsp.Header.Get("X-Accept-Encoding") != "" {
+		t.Errorf("Expected gzip body not asked, but got [%s]", rsp.Header.Get("X-Accept-Encoding"))
+	}
+
+	// without Compression the body is kept as received when Accept-Encoding is set
+	opt = DefaultOptions()
+	opt.Header.Set("Accept-Encoding", "gzip")
+	rsp, err = New(opt).Get(s.URL+"/gzip", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output == content || rsp.Encoding() != "gzip" || rsp.WireSize() != rsp.DecodedSize() {
+		t.Errorf("Expected gzip body, but got [%s] [%d/%d]", rsp.Encoding(), rsp.WireSize(), rsp.DecodedSize())
+	}
+}
@@ -0,0 +1,252 @@
+package fetch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// Jar is a cookie jar following the public suffix rules,
+// unlike cookiejar.Jar it can list, clear and persist its cookies.
+type Jar struct {
+	mu       sync.Mutex
+	jar      *cookiejar.Jar
+	entries  map[string]jarEntry
+	filename string
+}
+
+// jarEntry is a cookie stored in Jar
+type jarEntry struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http_only,omitempty"`
+	HostOnly bool      `json:"host_only,omitempty"`
+}
+
+// NewJar returns an in-memory cookie jar.
+func NewJar() *Jar {
+	return &Jar{
+		jar:     newCookieJar(),
+		entries: map[string]jarEntry{},
+	}
+}
+
+// NewFileJar returns a cookie jar saved in filename, cookies already
+// saved are loaded. Call Save to write the cookies back in file,
+// session cookies are kept as well.
+func NewFileJar(filename string) (*Jar, error) {
+	j := NewJar()
+	j.filename = filename
+
+	bs, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []jarEntry
+	if err := json.Unmarshal(bs, &entries); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.expired(now) {
+			continue
+		}
+		j.entries[e.key()] = e
+		j.jar.SetCookies(e.url(), []*http.Cookie{e.cookie()})
+	}
+	return j, nil
+}
+
+// newCookieJar returns cookiejar.Jar using the public suffix list
+func newCookieJar() *cookiejar.Jar {
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	return jar
+}
+
+// SetCookies implements http.CookieJar.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	for _, c := range cookies {
+		e, ok := newJarEntry(u, c, now)
+		if !ok {
+			continue
+		}
+
+		if e.expired(now) {
+			delete(j.entries, e.key())
+		} else {
+			j.entries[e.key()] = e
+		}
+	}
+	j.jar.SetCookies(u, cookies)
+}
+
+// Cookies implements http.CookieJar.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.jar.Cookies(u)
+}
+
+// DomainCookies returns the cookies stored for domain and its subdomains.
+func (j *Jar) DomainCookies(domain string) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	var cookies []*http.Cookie
+	for _, e := range j.entries {
+		if e.matchDomain(domain) && !e.expired(now) {
+			cookies = append(cookies, e.cookie())
+		}
+	}
+	return cookies
+}
+
+// Clear remove the cookies of domain and its subdomains.
+func (j *Jar) Clear(domain string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for key, e := range j.entries {
+		if e.matchDomain(domain) {
+			delete(j.entries, key)
+		}
+	}
+
+	// cookiejar.Jar can't remove cookies, rebuild it with the remaining ones
+	j.jar = newCookieJar()
+	for _, e := range j.entries {
+		j.jar.SetCookies(e.url(), []*http.Cookie{e.cookie()})
+	}
+}
+
+// Save write the cookies not expired in the file of NewFileJar.
+func (j *Jar) Save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.filename == "" {
+		return nil
+	}
+
+	now := time.Now()
+	entries := make([]jarEntry, 0, len(j.entries))
+	for _, e := range j.entries {
+		if !e.expired(now) {
+			entries = append(entries, e)
+		}
+	}
+
+	bs, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(j.filename, bs, 0600)
+}
+
+// newJarEntry validate the cookie received from u as RFC 6265 section 5.3
+func newJarEntry(u *url.URL, c *http.Cookie, now time.Time) (jarEntry, bool) {
+	host := strings.ToLower(u.Hostname())
+	e := jarEntry{
+		Name:     c.Name,
+		Value:    c.Value,
+		Domain:   strings.TrimPrefix(strings.ToLower(c.Domain), "."),
+		Path:     c.Path,
+		Expires:  c.Expires,
+		Secure:   c.Secure,
+		HttpOnly: c.HttpOnly,
+	}
+
+	switch {
+	case e.Domain == "" || e.Domain == host:
+		e.Domain, e.HostOnly = host, true
+	case !strings.HasSuffix(host, "."+e.Domain):
+		return e, false
+	case publicsuffix.List.PublicSuffix(e.Domain) == e.Domain:
+		return e, false
+	}
+
+	if e.Path == "" || e.Path[0] != '/' {
+		e.Path = defaultCookiePath(u.Path)
+	}
+
+	switch {
+	case c.MaxAge < 0:
+		e.Expires = time.Unix(1, 0)
+	case c.MaxAge > 0:
+		e.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+	}
+	return e, true
+}
+
+// defaultCookiePath returns the directory of path as RFC 6265 section 5.1.4
+func defaultCookiePath(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// key identify the cookie by domain, path and name
+func (e jarEntry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+// expired returns if the cookie is expired, session cookies never expire
+func (e jarEntry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// matchDomain returns if the cookie belongs to domain or its subdomains
+func (e jarEntry) matchDomain(domain string) bool {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	return e.Domain == domain || strings.HasSuffix(e.Domain, "."+domain)
+}
+
+// url returns an URL which the cookie can be set from
+func (e jarEntry) url() *url.URL {
+	scheme := "http"
+	if e.Secure {
+		scheme = "https"
+	}
+	return &url.URL{Scheme: scheme, Host: e.Domain, Path: e.Path}
+}
+
+// cookie convert the entry in http.Cookie
+func (e jarEntry) cookie() *http.Cookie {
+	c := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Path:     e.Path,
+		Expires:  e.Expires,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+	}
+	if !e.HostOnly {
+		c.Domain = e.Domain
+	}
+	return c
+}
@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetch_CookieJar(t *testing.T) {
+	var received string
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err == nil {
+			received = c.Value
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", Path: "/"})
+	})
+	defer s.Close()
+
+	f := NewDefault()
+	if f.Option.CookieJar == nil {
+		t.Fatal("Expected default cookie jar, but got nil")
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := f.Get(s.URL+"/login", nil); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+	}
+
+	if received != "abc" {
+		t.Errorf("Expected cookie [abc], but got [%s]", received)
+	}
+}
+
+func TestJar(t *testing.T) {
+	u, _ := url.Parse("https://www.example.com/account/login")
+
+	t.Run("Test-DomainCookies", func(t *testing.T) {
+		j := NewJar()
+		j.SetCookies(u, []*http.Cookie{
+			{Name: "host", Value: "1"},
+			{Name: "domain", Value: "2", Domain: ".example.com"},
+			{Name: "suffix", Value: "3", Domain: "com"},
+			{Name: "other", Value: "4", Domain: "other.com"},
+		})
+
+		if cookies := j.DomainCookies("example.com"); len(cookies) != 2 {
+			t.Errorf("Expected [2] cookies, but got [%v]", cookies)
+		}
+		if cookies := j.DomainCookies("www.example.com"); len(cookies) != 1 || cookies[0].Path != "/account" {
+			t.Errorf("Expected host cookie with path [/account], but got [%v]", cookies)
+		}
+
+		sub, _ := url.Parse("http://api.example.com/account/profile")
+		if cookies := j.Cookies(sub); len(cookies) != 1 || cookies[0].Name != "domain" {
+			t.Errorf("Expected domain cookie sent to subdomain, but got [%v]", cookies)
+		}
+	})
+
+	t.Run("Test-ExpiredAndClear", func(t *testing.T) {
+		j := NewJar()
+		j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1", Path: "/"}, {Name: "b", Value: "2", Path: "/"}})
+		j.SetCookies(u, []*http.Cookie{{Name: "a", Path: "/", MaxAge: -1}})
+
+		if cookies := j.Cookies(u); len(cookies) != 1 || cookies[0].Name != "b" {
+			t.Errorf("Expected only cookie [b], but got [%v]", cookies)
+		}
+
+		j.Clear("example.com")
+		if cookies := j.Cookies(u); len(cookies) != 0 {
+			t.Errorf("Expected none cookie, but got [%v]", cookies)
+		}
+		if cookies := j.DomainCookies("example.com"); len(cookies) != 0 {
+			t.Errorf("Expected none cookie, but got [%v]", cookies)
+		}
+	})
+
+	t.Run("Test-FileJar", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "fetch")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "cookies.json")
+
+		j, err := NewFileJar(filename)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		j.SetCookies(u, []*http.Cookie{
+			{Name: "session", Value: "abc", Path: "/", Secure: true},
+			{Name: "remember", Value: "yes", Path: "/", MaxAge: 3600},
+		})
+		if err := j.Save(); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+
+		loaded, err := NewFileJar(filename)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if cookies := loaded.Cookies(u); len(cookies) != 2 {
+			t.Errorf("Expected [2] cookies loaded, but got [%v]", cookies)
+		}
+
+		insecure, _ := url.Parse("http://www.example.com/")
+		if cookies := loaded.Cookies(insecure); len(cookies) != 1 || cookies[0].Name != "remember" {
+			t.Errorf("Expected secure cookie not sent over http, but got [%v]", cookies)
+		}
+	})
+}
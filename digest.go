@@ -0,0 +1,231 @@
+package fetch
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DigestAuth authenticate requests with HTTP Digest access authentication (RFC 7616).
+// The first request receives a 401 challenge and is replayed with credentials,
+// the nonce is cached by host so later requests skip the extra round trip.
+// DigestAuth must be used as pointer and is safe for concurrent use.
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu         sync.Mutex
+	challenges map[string]*digestChallenge
+}
+
+// digestChallenge keep the parameters of a challenge and its nonce count
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	nc        uint32
+}
+
+// Authenticate add the Authorization header when there is a cached challenge for the host.
+func (a *DigestAuth) Authenticate(req *http.Request) error {
+	a.mu.Lock()
+	ch, ok := a.challenges[req.URL.Host]
+	if !ok {
+		a.mu.Unlock()
+		return nil
+	}
+	ch.nc++
+	nc, challenge := ch.nc, *ch
+	a.mu.Unlock()
+
+	cnonce, err := newCNonce()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", a.authorization(&challenge, req.Method, req.URL.RequestURI(), cnonce, nc))
+	return nil
+}
+
+// Challenge parse WWW-Authenticate of response and cache the nonce,
+// it returns false when the challenge is not Digest or the credentials were refused.
+func (a *DigestAuth) Challenge(req *http.Request, rsp *http.Response) (bool, error) {
+	ch := selectDigestChallenge(rsp.Header["Www-Authenticate"])
+	if ch == nil {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.challenges == nil {
+		a.challenges = map[string]*digestChallenge{}
+	}
+
+	// a fresh challenge for the same nonce means the credentials are wrong
+	if previous, ok := a.challenges[req.URL.Host]; ok && previous.nonce == ch.nonce {
+		delete(a.challenges, req.URL.Host)
+		return false, nil
+	}
+
+	a.challenges[req.URL.Host] = ch
+	return true, nil
+}
+
+// authorization build the Authorization header value
+func (a *DigestAuth) authorization(ch *digestChallenge, method, uri, cnonce string, nc uint32) string {
+	algorithm := ch.algorithm
+	if algorithm == "" {
+		algorithm = "MD5"
+	}
+
+	count := fmt.Sprintf("%08x", nc)
+	params := []string{
+		fmt.Sprintf(`username="%s"`, a.Username),
+		fmt.Sprintf(`realm="%s"`, ch.realm),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`algorithm=%s`, algorithm),
+		fmt.Sprintf(`nonce="%s"`, ch.nonce),
+	}
+	if ch.qop != "" {
+		params = append(params, "nc="+count, fmt.Sprintf(`cnonce="%s"`, cnonce), "qop="+ch.qop)
+	}
+	params = append(params, fmt.Sprintf(`response="%s"`, a.response(ch, method, uri, cnonce, count)))
+	if ch.opaque != "" {
+		params = append(params, fmt.Sprintf(`opaque="%s"`, ch.opaque))
+	}
+
+	return "Digest " + strings.Join(params, ", ")
+}
+
+// response compute the digest of the request as RFC 7616 section 3.4.1
+func (a *DigestAuth) response(ch *digestChallenge, method, uri, cnonce, nc string) string {
+	h := digestHash(ch.algorithm)
+	if h == nil {
+		h = md5.New
+	}
+	sum := func(parts ...string) string {
+		d := h()
+		d.Write([]byte(strings.Join(parts, ":")))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	ha1 := sum(a.Username, ch.realm, a.Password)
+	if strings.HasSuffix(strings.ToUpper(ch.algorithm), "-SESS") {
+		ha1 = sum(ha1, ch.nonce, cnonce)
+	}
+	ha2 := sum(method, uri)
+
+	if ch.qop == "" {
+		return sum(ha1, ch.nonce, ha2)
+	}
+	return sum(ha1, ch.nonce, nc, cnonce, ch.qop, ha2)
+}
+
+// digestHash return the hash function of algorithm or nil if it's not supported
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	default:
+		return nil
+	}
+}
+
+// isSHA256 return if challenge uses SHA-256 or SHA-256-sess
+func (ch *digestChallenge) isSHA256() bool {
+	return strings.HasPrefix(strings.ToUpper(ch.algorithm), "SHA-256")
+}
+
+// selectDigestChallenge pick the strongest supported Digest challenge offering qop=auth or no qop
+func selectDigestChallenge(headers []string) *digestChallenge {
+	var selected *digestChallenge
+	for _, header := range headers {
+		if len(header) < 7 || !strings.EqualFold(header[:7], "Digest ") {
+			continue
+		}
+
+		params := parseAuthParams(header[7:])
+		ch := &digestChallenge{
+			realm:     params["realm"],
+			nonce:     params["nonce"],
+			opaque:    params["opaque"],
+			algorithm: params["algorithm"],
+		}
+
+		if qop, ok := params["qop"]; ok {
+			for _, option := range strings.Split(qop, ",") {
+				if strings.TrimSpace(option) == "auth" {
+					ch.qop = "auth"
+				}
+			}
+			if ch.qop == "" {
+				continue
+			}
+		}
+
+		if digestHash(ch.algorithm) == nil {
+			continue
+		}
+		if selected == nil || ch.isSHA256() && !selected.isSHA256() {
+			selected = ch
+		}
+	}
+	return selected
+}
+
+// parseAuthParams parse comma separated key=value pairs, values may be quoted
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var b strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i < len(s) {
+				i++
+			}
+			value, s = b.String(), s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// newCNonce return a random client nonce
+func newCNonce() (string, error) {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bs), nil
+}
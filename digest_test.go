@@ -0,0 +1,161 @@
+package fetch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDigestAuth_Response(t *testing.T) {
+	// values from the example of RFC 7616 section 3.9.1
+	auth := &DigestAuth{Username: "Mufasa", Password: "Circle of Life"}
+	tests := []struct {
+		algorithm string
+		output    string
+	}{
+		{algorithm: "MD5", output: "8ca523f5e9506fed4657c9700eebdbec"},
+		{algorithm: "SHA-256", output: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.algorithm), func(t *testing.T) {
+			ch := &digestChallenge{
+				realm:     "http-auth@example.org",
+				nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+				opaque:    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+				algorithm: test.algorithm,
+				qop:       "auth",
+			}
+
+			output := auth.response(ch, http.MethodGet, "/dir/index.html", "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", "00000001")
+			if output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+		})
+	}
+}
+
+func TestSelectDigestChallenge(t *testing.T) {
+	headers := []string{
+		`Basic realm="api"`,
+		`Digest realm="api", qop="auth, auth-int", algorithm=MD5, nonce="md5-nonce"`,
+		`Digest realm="api", qop="auth", algorithm=SHA-256, nonce="sha-nonce", opaque="op\"aque"`,
+		`Digest realm="api", qop="auth", algorithm=SHA-512-256, nonce="unsupported"`,
+	}
+
+	ch := selectDigestChallenge(headers)
+	if ch == nil {
+		t.Fatal("Expected a challenge, but got nil")
+	}
+	if ch.nonce != "sha-nonce" || ch.algorithm != "SHA-256" || ch.qop != "auth" {
+		t.Errorf("Expected SHA-256 challenge, but got [%+v]", ch)
+	}
+	if ch.opaque != `op"aque` {
+		t.Errorf("Expected opaque [%s], but got [%s]", `op"aque`, ch.opaque)
+	}
+
+	if ch := selectDigestChallenge(headers[:1]); ch != nil {
+		t.Errorf("Expected none challenge, but got [%+v]", ch)
+	}
+}
+
+// digestServer answer a Digest challenge and validate credentials
+func digestServer(username, password string, challenges *int, counts *[]string) http.HandlerFunc {
+	auth := &DigestAuth{Username: username, Password: password}
+	ch := &digestChallenge{realm: "fetch", nonce: "server-nonce", algorithm: "MD5", qop: "auth"}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if strings.HasPrefix(header, "Digest ") {
+			params := parseAuthParams(header[7:])
+			expected := auth.response(ch, r.Method, params["uri"], params["cnonce"], params["nc"])
+			if params["response"] == expected && params["nonce"] == ch.nonce {
+				*counts = append(*counts, params["nc"])
+				body, _ := ioutil.ReadAll(r.Body)
+				fmt.Fprintf(w, "%s", body)
+				return
+			}
+		}
+
+		*challenges++
+		w.Header().Add("WWW-Authenticate", `Digest realm="fetch", qop="auth", algorithm=MD5, nonce="server-nonce"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	t.Run("Test-ChallengeAndCache", func(t *testing.T) {
+		var challenges int
+		var counts []string
+		s := serverHandlerMock(digestServer("rodkranz", "secret", &challenges, &counts))
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Auth = &DigestAuth{Username: "rodkranz", Password: "secret"}
+		f := New(opt)
+
+		rsp, err := f.Post(s.URL+"/login?user=1", NewReader("payload"))
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if rsp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code [%d], but got [%d]", http.StatusOK, rsp.StatusCode)
+		}
+		if body := rsp.String(); body != `"payload"` {
+			t.Errorf("Expected body replayed [%s], but got [%s]", `"payload"`, body)
+		}
+
+		if _, err := f.Get(s.URL+"/profile", nil); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+
+		if challenges != 1 {
+			t.Errorf("Expected [1] challenge, but got [%d]", challenges)
+		}
+		if strings.Join(counts, ",") != "00000001,00000002" {
+			t.Errorf("Expected nonce count [00000001,00000002], but got [%s]", strings.Join(counts, ","))
+		}
+	})
+
+	t.Run("Test-WrongCredentials", func(t *testing.T) {
+		var challenges int
+		var counts []string
+		s := serverHandlerMock(digestServer("rodkranz", "secret", &challenges, &counts))
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Auth = &DigestAuth{Username: "rodkranz", Password: "wrong"}
+
+		rsp, err := New(opt).Get(s.URL, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if rsp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status code [%d], but got [%d]", http.StatusUnauthorized, rsp.StatusCode)
+		}
+		if challenges != 2 {
+			t.Errorf("Expected [2] challenges, but got [%d]", challenges)
+		}
+	})
+
+	t.Run("Test-NoDigestChallenge", func(t *testing.T) {
+		s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="fetch"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Auth = &DigestAuth{Username: "rodkranz", Password: "secret"}
+
+		rsp, err := New(opt).Get(s.URL, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if rsp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status code [%d], but got [%d]", http.StatusUnauthorized, rsp.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,394 @@
+package fetch
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DefaultDownloadChunks is the number of ranges downloaded in parallel.
+const DefaultDownloadChunks = 4
+
+// DefaultMinChunkSize is the smallest range downloaded in parallel.
+const DefaultMinChunkSize = 1 << 20
+
+var (
+	// ErrChecksum returns when the downloaded file doesn't match the checksum sent by server
+	ErrChecksum = errors.New("checksum mismatch")
+	// errRangeIgnored returns when the resource changed and the server sent it whole
+	errRangeIgnored = errors.New("range ignored by server")
+)
+
+// DownloadOptions configure Fetch.Download.
+type DownloadOptions struct {
+	// Chunks is the number of ranges downloaded in parallel, DefaultDownloadChunks when zero.
+	Chunks int
+	// MinChunkSize is the smallest range downloaded in parallel, DefaultMinChunkSize when zero.
+	MinChunkSize int64
+	// Progress is called after each write with the bytes written and the total size,
+	// total is -1 when unknown. Calls are serialized.
+	Progress func(written, total int64)
+	// SHA256 is the hex encoded SHA-256 expected of the file, verified with the
+	// Digest and Content-MD5 headers sent by the server.
+	SHA256 string
+}
+
+// downloadState is saved next to the partial file to resume the download
+type downloadState struct {
+	URL          string           `json:"url"`
+	ETag         string           `json:"etag,omitempty"`
+	LastModified string           `json:"last_modified,omitempty"`
+	Size         int64            `json:"size"`
+	Chunks       []*downloadChunk `json:"chunks"`
+}
+
+// downloadChunk is the inclusive range [Start, End] with Written bytes saved
+type downloadChunk struct {
+	Start   int64 `json:"start"`
+	End     int64 `json:"end"`
+	Written int64 `json:"written"`
+}
+
+// downloader download url into dst
+type downloader struct {
+	fetch  *Fetch
+	client *http.Client
+	url    string
+	dst    string
+	opt    DownloadOptions
+
+	mu      sync.Mutex
+	state   *downloadState
+	written int64
+}
+
+// Download saves url into dst, downloading byte ranges in parallel when the server accepts them.
+// The partial file dst+".part" and its state are kept on errors, so the next call resumes
+// with If-Range. The file is verified with the Digest or Content-MD5 headers before
+// being renamed to dst. Requests use the headers and authenticator of Options and are not
+// limited by Options.Timeout.
+func (f *Fetch) Download(ctx context.Context, url, dst string) error {
+	opt := DownloadOptions{}
+	if f.Option.Download != nil {
+		opt = *f.Option.Download
+	}
+	if opt.Chunks <= 0 {
+		opt.Chunks = DefaultDownloadChunks
+	}
+	if opt.MinChunkSize <= 0 {
+		opt.MinChunkSize = DefaultMinChunkSize
+	}
+
+	d := &downloader{
+		fetch:  f,
+		client: f.streamClient(),
+		url:    url,
+		dst:    dst,
+		opt:    opt,
+	}
+	return d.download(ctx)
+}
+
+// download probes the resource, resumes or starts the download and verifies it
+func (d *downloader) download(ctx context.Context) error {
+	probe, err := d.send(ctx, http.MethodHead, nil)
+	if err != nil {
+		return err
+	}
+	_ = probe.Body.Close()
+
+	header := probe.Header
+	if probe.StatusCode/100 != 2 || probe.ContentLength <= 0 || !headerContains(probe.Header, "Accept-Ranges", "bytes") {
+		if header, err = d.stream(ctx); err != nil {
+			return err
+		}
+	} else {
+		state := &downloadState{
+			URL:          d.url,
+			ETag:         probe.Header.Get("ETag"),
+			LastModified: probe.Header.Get("Last-Modified"),
+			Size:         probe.ContentLength,
+		}
+
+		err := d.ranges(ctx, d.resume(state))
+		if err == errRangeIgnored {
+			// the resource changed since the partial download
+			d.reset()
+			err = d.ranges(ctx, d.resume(state))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := verifyChecksum(d.partFile(), header, d.opt.SHA256); err != nil {
+		d.reset()
+		return err
+	}
+
+	_ = os.Remove(d.stateFile())
+	return os.Rename(d.partFile(), d.dst)
+}
+
+// partFile is the file receiving the download
+func (d *downloader) partFile() string {
+	return d.dst + ".part"
+}
+
+// stateFile is the file keeping the state of partFile
+func (d *downloader) stateFile() string {
+	return d.dst + ".part.json"
+}
+
+// reset removes the partial download
+func (d *downloader) reset() {
+	_ = os.Remove(d.partFile())
+	_ = os.Remove(d.stateFile())
+}
+
+// resume returns the state saved when it matches the resource, or splits it in new chunks
+func (d *downloader) resume(state *downloadState) *downloadState {
+	if data, err := ioutil.ReadFile(d.stateFile()); err == nil {
+		var saved downloadState
+		if json.Unmarshal(data, &saved) == nil && saved.URL == state.URL && saved.Size == state.Size &&
+			saved.ETag == state.ETag && saved.LastModified == state.LastModified {
+			if _, err := os.Stat(d.partFile()); err == nil {
+				return &saved
+			}
+		}
+	}
+	d.reset()
+
+	n := (state.Size + d.opt.MinChunkSize - 1) / d.opt.MinChunkSize
+	if n > int64(d.opt.Chunks) {
+		n = int64(d.opt.Chunks)
+	}
+
+	state.Chunks = make([]*downloadChunk, n)
+	for i := int64(0); i < n; i++ {
+		state.Chunks[i] = &downloadChunk{Start: i * state.Size / n, End: (i+1)*state.Size/n - 1}
+	}
+	return state
+}
+
+// ranges downloads the chunks of state in parallel and saves the state on return
+func (d *downloader) ranges(ctx context.Context, state *downloadState) error {
+	file, err := os.OpenFile(d.partFile(), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("couldn't download: %s", err)
+	}
+	defer file.Close()
+
+	d.state = state
+	d.written = 0
+	for _, chunk := range state.Chunks {
+		d.written += chunk.Written
+	}
+	defer d.saveState()
+
+	// chunks continue after an error of another one to save the most bytes
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for _, chunk := range state.Chunks {
+		if chunk.Start+chunk.Written > chunk.End {
+			continue
+		}
+
+		wg.Add(1)
+		go func(chunk *downloadChunk) {
+			defer wg.Done()
+			if err := d.chunk(ctx, file, chunk); err != nil {
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(chunk)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// chunk downloads the remaining bytes of chunk with If-Range
+func (d *downloader) chunk(ctx context.Context, file *os.File, chunk *downloadChunk) error {
+	d.mu.Lock()
+	offset := chunk.Start + chunk.Written
+	d.mu.Unlock()
+
+	header := http.Header{}
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, chunk.End))
+	// weak validators can't be used in If-Range
+	if etag := d.state.ETag; etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("If-Range", etag)
+	} else if d.state.LastModified != "" {
+		header.Set("If-Range", d.state.LastModified)
+	}
+
+	resp, err := d.send(ctx, http.MethodGet, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var start, end, size int64
+		if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != offset || size != d.state.Size {
+			return fmt.Errorf("couldn't download: unexpected Content-Range %q", resp.Header.Get("Content-Range"))
+		}
+	case http.StatusOK:
+		return errRangeIgnored
+	default:
+		return fmt.Errorf("couldn't download: unexpected status %s", resp.Status)
+	}
+
+	w := &chunkWriter{downloader: d, file: file, chunk: chunk}
+	if _, err := io.Copy(w, io.LimitReader(resp.Body, chunk.End-offset+1)); err != nil {
+		return fmt.Errorf("couldn't download: %s", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if chunk.Start+chunk.Written <= chunk.End {
+		return fmt.Errorf("couldn't download: %s", io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// stream downloads the whole resource in a single request and returns its headers
+func (d *downloader) stream(ctx context.Context) (http.Header, error) {
+	d.reset()
+
+	resp, err := d.send(ctx, http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("couldn't download: unexpected status %s", resp.Status)
+	}
+
+	file, err := os.Create(d.partFile())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download: %s", err)
+	}
+	defer file.Close()
+
+	d.state = &downloadState{Size: resp.ContentLength}
+	chunk := &downloadChunk{End: resp.ContentLength - 1}
+	if _, err := io.Copy(&chunkWriter{downloader: d, file: file, chunk: chunk}, resp.Body); err != nil {
+		return nil, fmt.Errorf("couldn't download: %s", err)
+	}
+	return resp.Header, nil
+}
+
+// send sends a request of url with header
+func (d *downloader) send(ctx context.Context, method string, header http.Header) (*Response, error) {
+	req, err := NewRequest(method, d.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't request %s: %s", method, err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	return d.fetch.do(req.WithContext(ctx), func(req *http.Request) (*http.Response, error) {
+		return ctxhttp.Do(req.Context(), d.client, req)
+	})
+}
+
+// saveState writes the state next to the partial file
+func (d *downloader) saveState() {
+	d.mu.Lock()
+	data, err := json.Marshal(d.state)
+	d.mu.Unlock()
+
+	if err == nil {
+		_ = ioutil.WriteFile(d.stateFile(), data, 0644)
+	}
+}
+
+// chunkWriter writes the bytes of chunk in file and reports the progress
+type chunkWriter struct {
+	*downloader
+	file  *os.File
+	chunk *downloadChunk
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	offset := w.chunk.Start + w.chunk.Written
+	w.mu.Unlock()
+
+	n, err := w.file.WriteAt(p, offset)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.chunk.Written += int64(n)
+	w.written += int64(n)
+	if w.opt.Progress != nil {
+		w.opt.Progress(w.written, w.state.Size)
+	}
+	return n, err
+}
+
+// verifyChecksum compares the file with the hex encoded sha256sum and the Digest
+// (RFC 3230) or Content-MD5 headers, MD5 is skipped when SHA-256 is known
+func verifyChecksum(filename string, header http.Header, sha256sum string) error {
+	expected := map[string]string{}
+	for _, value := range header["Digest"] {
+		for _, digest := range strings.Split(value, ",") {
+			if i := strings.IndexByte(digest, '='); i > 0 {
+				expected[strings.ToLower(strings.TrimSpace(digest[:i]))] = strings.TrimSpace(digest[i+1:])
+			}
+		}
+	}
+	if md5sum := header.Get("Content-MD5"); md5sum != "" && expected["md5"] == "" {
+		expected["md5"] = md5sum
+	}
+
+	var h hash.Hash
+	algorithm := "sha-256"
+	switch {
+	case expected["sha-256"] != "" || sha256sum != "":
+		h = sha256.New()
+	case expected["md5"] != "":
+		h, algorithm = md5.New(), "md5"
+	default:
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("couldn't verify download: %s", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return fmt.Errorf("couldn't verify download: %s", err)
+	}
+	sum := h.Sum(nil)
+	if sha256sum != "" && !strings.EqualFold(hex.EncodeToString(sum), sha256sum) {
+		return fmt.Errorf("%w: sha-256 expected %s, but got %x", ErrChecksum, sha256sum, sum)
+	}
+	if encoded := base64.StdEncoding.EncodeToString(sum); expected[algorithm] != "" && encoded != expected[algorithm] {
+		return fmt.Errorf("%w: %s expected %s, but got %s", ErrChecksum, algorithm, expected[algorithm], encoded)
+	}
+	return nil
+}
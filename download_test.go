@@ -0,0 +1,232 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// downloadServer serves content with ranges and records the Range headers received
+type downloadServer struct {
+	content []byte
+	etag    string
+	// abort is the number of bytes sent before aborting range requests, disabled when zero
+	abort int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if rng := r.Header.Get("Range"); rng != "" {
+		s.ranges = append(s.ranges, rng+" "+r.Header.Get("If-Range"))
+	}
+	abort, etag := s.abort, s.etag
+	s.mu.Unlock()
+
+	sum := sha256.Sum256(s.content)
+	w.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	w.Header().Set("ETag", etag)
+
+	var start, end int
+	if abort > 0 && r.Header.Get("Range") != "" {
+		fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(s.content)))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(s.content[start : start+abort])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.content))
+}
+
+func (s *downloadServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.ranges...)
+}
+
+func TestFetch_Download(t *testing.T) {
+	content := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	ds := &downloadServer{content: content, etag: `"v1"`}
+	s := serverHandlerMock(ds.ServeHTTP)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "file.bin")
+
+	var written, total int64
+	opt := DefaultOptions()
+	opt.Timeout = 50 * time.Millisecond
+	opt.Download = &DownloadOptions{
+		Chunks:       4,
+		MinChunkSize: 1000,
+		Progress:     func(w, t int64) { written, total = w, t },
+	}
+
+	if err := New(opt).Download(context.Background(), s.URL, dst); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	if output, _ := ioutil.ReadFile(dst); !bytes.Equal(output, content) {
+		t.Errorf("Expected content of [%d] bytes, but got [%d] bytes", len(content), len(output))
+	}
+	expected := `bytes=0-2499 "v1" bytes=2500-4999 "v1" bytes=5000-7499 "v1" bytes=7500-9999 "v1"`
+	ranges := ds.requests()
+	sort.Strings(ranges)
+	if output := strings.Join(ranges, " "); output != expected {
+		t.Errorf("Expected ranges [%s], but got [%s]", expected, output)
+	}
+	if written != 10000 || total != 10000 {
+		t.Errorf("Expected progress [10000/10000], but got [%d/%d]", written, total)
+	}
+	if _, err := os.Stat(dst + ".part.json"); !os.IsNotExist(err) {
+		t.Errorf("Expected state removed, but got [%v]", err)
+	}
+}
+
+func TestFetch_DownloadResume(t *testing.T) {
+	content := make([]byte, 4000)
+	rand.New(rand.NewSource(2)).Read(content)
+
+	ds := &downloadServer{content: content, etag: `"v1"`, abort: 100}
+	s := serverHandlerMock(ds.ServeHTTP)
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "file.bin")
+
+	opt := DefaultOptions()
+	opt.Download = &DownloadOptions{Chunks: 2, MinChunkSize: 1000}
+	f := New(opt)
+
+	if err := f.Download(context.Background(), s.URL, dst); err == nil {
+		t.Fatal("Expected aborted download, but got none error")
+	}
+	if _, err := os.Stat(dst + ".part.json"); err != nil {
+		t.Fatalf("Expected state saved, but got [%s]", err)
+	}
+
+	ds.mu.Lock()
+	ds.abort, ds.ranges = 0, nil
+	ds.mu.Unlock()
+
+	if err := f.Download(context.Background(), s.URL, dst); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output, _ := ioutil.ReadFile(dst); !bytes.Equal(output, content) {
+		t.Error("Expected content resumed, but got different content")
+	}
+	for _, rng := range ds.requests() {
+		if rng != `bytes=100-1999 "v1"` && rng != `bytes=2100-3999 "v1"` {
+			t.Errorf("Expected ranges resumed after [100] bytes, but got [%s]", rng)
+		}
+	}
+
+	// the state of another version is discarded
+	if err := ioutil.WriteFile(dst+".part.json", []byte(`{"url":"`+s.URL+`","etag":"\"v0\"","size":4000,"chunks":[{"start":0,"end":3999,"written":3000}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = ioutil.WriteFile(dst+".part", make([]byte, 3000), 0644)
+
+	ds.mu.Lock()
+	ds.ranges = nil
+	ds.mu.Unlock()
+
+	if err := f.Download(context.Background(), s.URL, dst); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output, _ := ioutil.ReadFile(dst); !bytes.Equal(output, content) {
+		t.Error("Expected content downloaded again, but got different content")
+	}
+	if ranges := ds.requests(); len(ranges) != 2 || !strings.HasPrefix(ranges[0], "bytes=0-") && !strings.HasPrefix(ranges[1], "bytes=0-") {
+		t.Errorf("Expected download from start, but got [%v]", ranges)
+	}
+}
+
+func TestFetch_DownloadChecksum(t *testing.T) {
+	content := []byte("content without ranges")
+	sum := md5.Sum(content)
+
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid" {
+			w.Header().Set("Digest", "SHA-256=invalid")
+		} else {
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		_, _ = w.Write(content)
+	})
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f := NewDefault()
+	dst := filepath.Join(dir, "valid.txt")
+	if err := f.Download(context.Background(), s.URL+"/valid", dst); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output, _ := ioutil.ReadFile(dst); string(output) != string(content) {
+		t.Errorf("Expected [%s], but got [%s]", content, output)
+	}
+
+	dst = filepath.Join(dir, "invalid.txt")
+	if err := f.Download(context.Background(), s.URL+"/invalid", dst); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected [%s], but got [%v]", ErrChecksum, err)
+	}
+	if _, err := os.Stat(dst + ".part"); !os.IsNotExist(err) {
+		t.Errorf("Expected partial file removed, but got [%v]", err)
+	}
+
+	sha := sha256.Sum256(content)
+	tests := []struct {
+		desc   string
+		sha256 string
+		err    error
+	}{
+		{desc: "SHA256", sha256: hex.EncodeToString(sha[:])},
+		{desc: "SHA256-Upper", sha256: strings.ToUpper(hex.EncodeToString(sha[:]))},
+		{desc: "SHA256-Invalid", sha256: strings.Repeat("0", 64), err: ErrChecksum},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.Download = &DownloadOptions{SHA256: test.sha256}
+
+			dst := filepath.Join(dir, test.desc+".txt")
+			if err := New(opt).Download(context.Background(), s.URL+"/valid", dst); !errors.Is(err, test.err) {
+				t.Errorf("Expected [%v], but got [%v]", test.err, err)
+			}
+		})
+	}
+}
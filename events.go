@@ -0,0 +1,317 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DefaultEventRetry is the time waited before reconnecting an event stream
+// when the server doesn't send a retry field.
+const DefaultEventRetry = 3 * time.Second
+
+// maxEventLine is the longest line accepted in an event stream
+const maxEventLine = 1 << 20
+
+// ErrNotEventStream returns when the response isn't a text/event-stream
+var ErrNotEventStream = errors.New("the response is not an event stream")
+
+// Event is a message received from a Server-Sent Events stream.
+type Event struct {
+	// ID is the last event ID of stream when the event was dispatched.
+	ID string
+	// Event is the event type, "message" when the server doesn't send one.
+	Event string
+	// Data is the data of event, lines joined by "\n".
+	Data string
+	// Retry is the reconnection time sent with the event, zero when absent.
+	Retry time.Duration
+}
+
+// EventStream receive the events of a Server-Sent Events stream and
+// reconnect with Last-Event-ID when the connection is lost.
+type EventStream struct {
+	fetch  *Fetch
+	client *http.Client
+	url    string
+	events chan Event
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	lastID string
+	retry  time.Duration
+	err    error
+}
+
+// Events connect to url and returns the stream of its events, the request
+// uses the headers and authenticator of Options. Streams are not limited by
+// Options.Timeout, cancel ctx or call Close to stop it.
+func (f *Fetch) Events(ctx context.Context, url string) (*EventStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &EventStream{
+		fetch:  f,
+		client: f.streamClient(),
+		url:    url,
+		events: make(chan Event),
+		cancel: cancel,
+		retry:  DefaultEventRetry,
+	}
+
+	resp, err := s.connect(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	go s.run(ctx, resp)
+	return s, nil
+}
+
+// Events returns the channel of events, it's closed when the stream stops.
+func (s *EventStream) Events() <-chan Event {
+	return s.events
+}
+
+// LastEventID returns the ID sent in the Last-Event-ID header when reconnecting.
+func (s *EventStream) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Err returns the error which stopped the stream, nil when it was closed or its context canceled.
+func (s *EventStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stop the stream and close its connection.
+func (s *EventStream) Close() {
+	s.cancel()
+}
+
+// connect request the stream, errors of response are not retried
+func (s *EventStream) connect(ctx context.Context) (*http.Response, error) {
+	req, err := NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't request event stream: %s", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if id := s.LastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+
+	rsp, err := s.fetch.do(req.WithContext(ctx), func(req *http.Request) (*http.Response, error) {
+		return ctxhttp.Do(req.Context(), s.client, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, rsp.Body)
+		_ = rsp.Body.Close()
+		return nil, &eventStreamError{fmt.Errorf("unexpected status of event stream: %s", rsp.Status)}
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(rsp.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		_ = rsp.Body.Close()
+		return nil, &eventStreamError{ErrNotEventStream}
+	}
+
+	return rsp.Response, nil
+}
+
+// eventStreamError is an error of the server which stops the stream
+type eventStreamError struct {
+	err error
+}
+
+func (e *eventStreamError) Error() string {
+	return e.err.Error()
+}
+
+// run read the events of resp and reconnect until the stream is stopped
+func (s *EventStream) run(ctx context.Context, resp *http.Response) {
+	defer close(s.events)
+	defer s.cancel()
+
+	for {
+		s.read(ctx, resp.Body)
+		_ = resp.Body.Close()
+
+		for resp = nil; resp == nil; {
+			s.mu.Lock()
+			retry := s.retry
+			s.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retry):
+			}
+
+			var err error
+			if resp, err = s.connect(ctx); err != nil {
+				if _, ok := err.(*eventStreamError); ok {
+					s.mu.Lock()
+					s.err = err
+					s.mu.Unlock()
+					return
+				}
+			}
+		}
+	}
+}
+
+// read dispatch the events of body until it ends or the stream is stopped
+func (s *EventStream) read(ctx context.Context, body io.Reader) {
+	p := newEventParser(body, s.LastEventID())
+	for {
+		event, ok := p.next()
+
+		s.mu.Lock()
+		s.lastID = p.lastID
+		if p.retry > 0 {
+			s.retry = p.retry
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			return
+		}
+
+		select {
+		case s.events <- event:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// eventParser parse a text/event-stream following the WHATWG rules
+type eventParser struct {
+	scanner *bufio.Scanner
+	started bool
+	// id is the last event ID buffer, lastID is set from it when an event is dispatched
+	id     string
+	lastID string
+	retry  time.Duration
+}
+
+// newEventParser returns a parser of r, the last event ID buffer persists
+// between connections so it starts with lastID
+func newEventParser(r io.Reader, lastID string) *eventParser {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 4096), maxEventLine)
+	scanner.Split(scanEventLines)
+	return &eventParser{scanner: scanner, id: lastID, lastID: lastID}
+}
+
+// next returns the next event dispatched, false when the stream ends
+// and the incomplete event is discarded
+func (p *eventParser) next() (Event, bool) {
+	var (
+		data      bytes.Buffer
+		eventType string
+		retry     time.Duration
+	)
+
+	for p.scanner.Scan() {
+		line := p.scanner.Text()
+		// the stream may start with a byte order mark
+		if !p.started {
+			line = strings.TrimPrefix(line, "\ufeff")
+			p.started = true
+		}
+
+		if line == "" {
+			p.lastID = p.id
+			if data.Len() == 0 {
+				eventType, retry = "", 0
+				continue
+			}
+
+			event := Event{
+				ID:    p.lastID,
+				Event: eventType,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: retry,
+			}
+			if event.Event == "" {
+				event.Event = "message"
+			}
+			return event, true
+		}
+
+		// comment
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+
+		switch field {
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				p.id = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+				p.retry = retry
+			}
+		}
+	}
+
+	return Event{}, false
+}
+
+// scanEventLines split lines ended by CRLF, LF or CR
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+		// CR may be followed by LF in the next read
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	}
+
+	// the last line without end is discarded with the incomplete event
+	if atEOF {
+		return len(data), nil, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,224 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventParser(t *testing.T) {
+	tests := []struct {
+		desc   string
+		input  string
+		output []Event
+		lastID string
+	}{
+		{
+			desc:   "Simple",
+			input:  "data: hello\n\n",
+			output: []Event{{Event: "message", Data: "hello"}},
+		},
+		{
+			desc:   "MultiLine",
+			input:  "data: YHOO\ndata: +2\ndata: 10\n\n",
+			output: []Event{{Event: "message", Data: "YHOO\n+2\n10"}},
+		},
+		{
+			desc:  "Fields",
+			input: ": test stream\n\nevent: add\nid: 1\nretry: 1500\ndata:first\n\ndata: second\n\n",
+			output: []Event{
+				{ID: "1", Event: "add", Data: "first", Retry: 1500 * time.Millisecond},
+				{ID: "1", Event: "message", Data: "second"},
+			},
+			lastID: "1",
+		},
+		{
+			desc:   "LineEnds",
+			input:  "\ufeffdata: a\r\ndata: b\rdata\r\n\r\n",
+			output: []Event{{Event: "message", Data: "a\nb\n"}},
+		},
+		{
+			desc:   "IDWithoutData",
+			input:  "id: 7\n\ndata:  spaced\nid\n\n",
+			output: []Event{{Event: "message", Data: " spaced"}},
+		},
+		{
+			desc:   "InvalidRetry",
+			input:  "retry: 1s\nid: a\x00b\ndata: x\n\n",
+			output: []Event{{Event: "message", Data: "x"}},
+		},
+		{
+			desc:   "Incomplete",
+			input:  "data: done\n\ndata: lost\n",
+			output: []Event{{Event: "message", Data: "done"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			p := newEventParser(strings.NewReader(test.input), "")
+
+			var output []Event
+			for {
+				event, ok := p.next()
+				if !ok {
+					break
+				}
+				output = append(output, event)
+			}
+
+			if fmt.Sprint(output) != fmt.Sprint(test.output) {
+				t.Errorf("Expected %q, but got %q", test.output, output)
+			}
+			if p.lastID != test.lastID {
+				t.Errorf("Expected last ID [%s], but got [%s]", test.lastID, p.lastID)
+			}
+		})
+	}
+}
+
+func TestFetch_Events(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, fmt.Sprintf("%s|%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-Feed"), r.Header.Get("Last-Event-ID")))
+		n := len(requests)
+		mu.Unlock()
+
+		switch n {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "retry: 10\n\nid: 1\ndata: one\n\nid: 2\nevent: update\ndata: two\n\n")
+		case 2:
+			w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+			fmt.Fprint(w, "id: 3\ndata: three\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.Timeout = 50 * time.Millisecond
+	opt.Header.Set("X-Feed", "prices")
+	opt.Auth = BearerAuth{Token: "token"}
+
+	stream, err := New(opt).Events(context.Background(), s.URL)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	var output []string
+	for event := range stream.Events() {
+		output = append(output, event.ID+":"+event.Event+":"+event.Data)
+	}
+
+	expected := "1:message:one 2:update:two 3:message:three"
+	if strings.Join(output, " ") != expected {
+		t.Errorf("Expected [%s], but got [%s]", expected, strings.Join(output, " "))
+	}
+	if stream.Err() == nil {
+		t.Error("Expected status error, but got none error")
+	}
+	if stream.LastEventID() != "3" {
+		t.Errorf("Expected last event ID [3], but got [%s]", stream.LastEventID())
+	}
+
+	expected = "Bearer token|prices| Bearer token|prices|2 Bearer token|prices|3"
+	if strings.Join(requests, " ") != expected {
+		t.Errorf("Expected requests [%s], but got [%s]", expected, strings.Join(requests, " "))
+	}
+}
+
+func TestFetch_EventsReconnect(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Header.Get("Last-Event-ID"))
+		n := len(requests)
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch n {
+		case 1:
+			fmt.Fprint(w, "retry: 10\nid: 7\ndata: one\n\n")
+		case 2:
+			// the connection ends before any event
+		case 3:
+			fmt.Fprint(w, "data: two\n\n")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	defer s.Close()
+
+	stream, err := NewDefault().Events(context.Background(), s.URL)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	var output []string
+	for event := range stream.Events() {
+		output = append(output, event.ID+":"+event.Data)
+	}
+
+	if expected := "7:one 7:two"; strings.Join(output, " ") != expected {
+		t.Errorf("Expected [%s], but got [%s]", expected, strings.Join(output, " "))
+	}
+	if expected := "|7|7|7"; strings.Join(requests, "|") != expected {
+		t.Errorf("Expected Last-Event-ID [%s], but got [%s]", expected, strings.Join(requests, "|"))
+	}
+}
+
+func TestFetch_EventsClose(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/json" {
+			fmt.Fprint(w, `{}`)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: ping\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	defer s.Close()
+
+	f := NewDefault()
+	if _, err := f.Events(context.Background(), s.URL+"/json"); err == nil || !strings.Contains(err.Error(), ErrNotEventStream.Error()) {
+		t.Errorf("Expected [%s], but got [%v]", ErrNotEventStream, err)
+	}
+
+	stream, err := f.Events(context.Background(), s.URL)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if event := <-stream.Events(); event.Data != "ping" {
+		t.Errorf("Expected [ping], but got [%s]", event.Data)
+	}
+
+	stream.Close()
+	select {
+	case _, ok := <-stream.Events():
+		if ok {
+			t.Error("Expected channel closed, but got event")
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected channel closed, but got timeout")
+	}
+	if err := stream.Err(); err != nil {
+		t.Errorf("Expected none error, but got [%s]", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"fmt"
 
@@ -19,15 +20,10 @@ func main() {
 	USERNAME := "rodkranz"
 
 	f := fetch.NewDefault()
-	rsp, err := f.Get(fmt.Sprintf(url, USERNAME), nil)
+	user, _, err := fetch.GetJSON[GitHubUser](context.Background(), f, fmt.Sprintf(url, USERNAME))
 	if err != nil {
 		log.Fatalf("could not fetch [%s] because: %s", url, err)
 	}
 
-	var user GitHubUser
-	if err := rsp.Decode(&user); err != nil {
-		log.Fatalf("could not fetch [%s] because: %s", url, err)
-	}
-
 	fmt.Printf("Name: %s\nCompany: %s\nLocation: %s\n", user.Name, user.Company, user.Location)
 }
@@ -1,5 +1,7 @@
 module github.com/rodkranz/fetch
 
-go 1.13
+go 1.18
 
-require golang.org/x/net v0.0.0-20180801234040-f4c29de78a2a
+require golang.org/x/net v0.35.0
+
+require golang.org/x/text v0.22.0 // indirect
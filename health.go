@@ -0,0 +1,177 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Defaults of HealthCheckOptions.
+const (
+	DefaultHealthCheckPath     = "/health"
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+	DefaultHealthyThreshold    = 2
+	DefaultUnhealthyThreshold  = 3
+)
+
+// HealthCheckOptions configure the active health checks of the endpoints of
+// Options.LoadBalancer. Endpoints start healthy, requests aren't sent to the
+// unhealthy ones unless every endpoint is unavailable. The checks run until
+// Fetch.Close is called.
+type HealthCheckOptions struct {
+	// Path is probed with GET on each endpoint, DefaultHealthCheckPath when empty.
+	// A 2xx status is healthy.
+	Path string
+	// Interval is the time between probes, DefaultHealthCheckInterval when zero.
+	Interval time.Duration
+	// Timeout limits each probe, DefaultHealthCheckTimeout when zero.
+	Timeout time.Duration
+	// HealthyThreshold is the number of successes in a row marking an unhealthy
+	// endpoint healthy, DefaultHealthyThreshold when zero.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of failures in a row marking a healthy
+	// endpoint unhealthy, DefaultUnhealthyThreshold when zero.
+	UnhealthyThreshold int
+	// OnChange is called when an endpoint becomes healthy or unhealthy.
+	OnChange func(endpoint string, healthy bool)
+}
+
+// healthChecker probes the endpoints of a load balancer
+type healthChecker struct {
+	opt    *HealthCheckOptions
+	lb     *LoadBalancerOptions
+	client *http.Client
+	auth   Authenticator
+
+	ctx  context.Context
+	stop context.CancelFunc
+	wg   sync.WaitGroup
+}
+
+// startHealthChecker starts a goroutine probing each endpoint of lb
+func startHealthChecker(opt *HealthCheckOptions, lb *LoadBalancerOptions, client *http.Client, auth Authenticator) (*healthChecker, error) {
+	if lb == nil {
+		return nil, errors.New("health check without load balancer")
+	}
+	if err := lb.init(); err != nil {
+		return nil, err
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	h := &healthChecker{opt: opt, lb: lb, client: client, auth: auth, ctx: ctx, stop: stop}
+	for _, e := range lb.endpoints {
+		h.wg.Add(1)
+		go h.run(e)
+	}
+	return h, nil
+}
+
+// run probes e at every interval until the checker is closed
+func (h *healthChecker) run(e *endpoint) {
+	defer h.wg.Done()
+
+	interval := h.opt.Interval
+	if interval <= 0 {
+		interval = DefaultHealthCheckInterval
+	}
+	healthyThreshold := h.opt.HealthyThreshold
+	if healthyThreshold <= 0 {
+		healthyThreshold = DefaultHealthyThreshold
+	}
+	unhealthyThreshold := h.opt.UnhealthyThreshold
+	if unhealthyThreshold <= 0 {
+		unhealthyThreshold = DefaultUnhealthyThreshold
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	healthy, successes, failures := true, 0, 0
+	for {
+		if h.probe(e) {
+			successes, failures = successes+1, 0
+		} else {
+			successes, failures = 0, failures+1
+		}
+
+		if healthy && failures >= unhealthyThreshold || !healthy && successes >= healthyThreshold {
+			healthy = !healthy
+			h.lb.setHealthy(e, healthy)
+			if h.opt.OnChange != nil {
+				h.opt.OnChange(e.url.String(), healthy)
+			}
+		}
+
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe reports whether the health check of e succeeds
+func (h *healthChecker) probe(e *endpoint) bool {
+	timeout := h.opt.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+	path := h.opt.Path
+	if path == "" {
+		path = DefaultHealthCheckPath
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return false
+	}
+	req = withBaseURL(req.WithContext(ctx), e.url)
+	if h.auth != nil {
+		if err := h.auth.Authenticate(req); err != nil {
+			return false
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+}
+
+// close stops the probes and waits their goroutines
+func (h *healthChecker) close() {
+	h.stop()
+	h.wg.Wait()
+}
+
+// Health returns the state of the endpoints of Options.LoadBalancer, nil without load balancer.
+func (f *Fetch) Health() []EndpointStatus {
+	if f.Option.LoadBalancer == nil {
+		return nil
+	}
+	return f.Option.LoadBalancer.Status()
+}
+
+// Close stops the health checks and closes the idle connections, requests
+// can still be sent after Close.
+func (f *Fetch) Close() error {
+	if f.health != nil {
+		f.health.close()
+	}
+	f.Client.CloseIdleConnections()
+	if f.websocket != nil {
+		f.websocket.CloseIdleConnections()
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// healthChange is a call of HealthCheckOptions.OnChange
+type healthChange struct {
+	endpoint string
+	healthy  bool
+}
+
+func TestHealthCheckOptions(t *testing.T) {
+	var down, probes int32
+	handler := func(name string, flag *int32) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/ready" {
+				fmt.Fprint(w, name)
+				return
+			}
+			atomic.AddInt32(&probes, 1)
+			switch {
+			case r.Header.Get("Authorization") != "Bearer token":
+				w.WriteHeader(http.StatusUnauthorized)
+			case flag != nil && atomic.LoadInt32(flag) == 1:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}
+	a := serverHandlerMock(handler("a", nil))
+	defer a.Close()
+	b := serverHandlerMock(handler("b", &down))
+	defer b.Close()
+
+	changes := make(chan healthChange, 10)
+	opt := DefaultOptions()
+	opt.Auth = BearerAuth{Token: "token"}
+	opt.LoadBalancer = &LoadBalancerOptions{Endpoints: []Endpoint{{URL: a.URL}, {URL: b.URL}}}
+	opt.HealthCheck = &HealthCheckOptions{
+		Path:               "/ready",
+		Interval:           10 * time.Millisecond,
+		HealthyThreshold:   2,
+		UnhealthyThreshold: 2,
+		OnChange: func(endpoint string, healthy bool) {
+			changes <- healthChange{endpoint: endpoint, healthy: healthy}
+		},
+	}
+	f := New(opt)
+
+	expectChange := func(expected healthChange) {
+		t.Helper()
+		select {
+		case change := <-changes:
+			if change != expected {
+				t.Errorf("Expected [%+v], but got [%+v]", expected, change)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected [%+v], but got none change", expected)
+		}
+	}
+
+	atomic.StoreInt32(&down, 1)
+	expectChange(healthChange{endpoint: b.URL, healthy: false})
+	if status := f.Health(); !status[0].Healthy || status[1].Healthy {
+		t.Errorf("Expected second endpoint unhealthy, but got [%+v]", status)
+	}
+	if names := strings.Join(balancedNames(t, f, context.Background(), 4), ","); names != "a,a,a,a" {
+		t.Errorf("Expected [a,a,a,a], but got [%s]", names)
+	}
+
+	atomic.StoreInt32(&down, 0)
+	expectChange(healthChange{endpoint: b.URL, healthy: true})
+	if status := f.Health(); !status[0].Healthy || !status[1].Healthy {
+		t.Errorf("Expected endpoints healthy, but got [%+v]", status)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	closed := atomic.LoadInt32(&probes)
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(&probes); n != closed {
+		t.Errorf("Expected probes stopped by Close, but got [%d] more", n-closed)
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Expected second Close without error, but got [%s]", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected none other change, but got [%d]", len(changes))
+	}
+}
+
+func TestHealthCheckOptions_WithoutLoadBalancer(t *testing.T) {
+	opt := DefaultOptions()
+	opt.HealthCheck = &HealthCheckOptions{}
+	f := New(opt)
+	defer f.Close()
+
+	if _, err := f.Get("http://localhost/", nil); err == nil || !strings.Contains(err.Error(), "without load balancer") {
+		t.Errorf("Expected load balancer error, but got [%v]", err)
+	}
+	if status := f.Health(); status != nil {
+		t.Errorf("Expected none status, but got [%+v]", status)
+	}
+}
@@ -0,0 +1,330 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Defaults of HedgeOptions.
+const (
+	DefaultHedgeBudget     = 0.1
+	DefaultHedgeMinSamples = 20
+)
+
+// hedgeSamples is the number of latencies kept to compute the percentile delay
+const hedgeSamples = 1000
+
+// hedgeBurst is the number of hedges allowed at once by the budget
+const hedgeBurst = 10
+
+// HedgeOptions configure hedged requests: when an idempotent GET or HEAD gets no
+// response within the delay, a duplicate request is sent and the first success is
+// used, the other requests are canceled. Responses with status 5xx aren't success.
+// The options keep the latencies and the budget, share them only between clients
+// of the same service.
+type HedgeOptions struct {
+	// Delay is the time waited before sending a hedge, used until Percentile has
+	// enough samples. Requests aren't hedged while the delay is zero, their
+	// latencies are collected for Percentile meanwhile.
+	Delay time.Duration
+	// Percentile, between 0 and 1 (eg. 0.95), computes the delay from the latencies
+	// of recent responses once MinSamples are collected.
+	Percentile float64
+	// MinSamples is the number of latencies needed by Percentile, DefaultHedgeMinSamples when zero.
+	MinSamples int
+	// MaxHedges is the number of hedges per request, 1 when zero.
+	MaxHedges int
+	// Budget caps the extra load as hedges per request, DefaultHedgeBudget when zero.
+	Budget float64
+	// Hosts are base URLs, eg. https://replica-2.example.com, used by hedges in turn
+	// instead of the host of request.
+	Hosts []string
+
+	requests int64
+	hedges   int64
+	wins     int64
+
+	mu      sync.Mutex
+	tokens  float64
+	started bool
+	samples []time.Duration
+	next    int
+}
+
+// HedgeStats counts the requests hedged by HedgeOptions.
+type HedgeStats struct {
+	// Requests is the number of requests which could be hedged.
+	Requests int64
+	// Hedges is the number of hedges sent.
+	Hedges int64
+	// Wins is the number of hedges whose response was used.
+	Wins int64
+}
+
+// Stats returns the hedges sent and won.
+func (o *HedgeOptions) Stats() HedgeStats {
+	return HedgeStats{
+		Requests: atomic.LoadInt64(&o.requests),
+		Hedges:   atomic.LoadInt64(&o.hedges),
+		Wins:     atomic.LoadInt64(&o.wins),
+	}
+}
+
+// delay returns the time waited before hedging
+func (o *HedgeOptions) delay() time.Duration {
+	minSamples := o.MinSamples
+	if minSamples <= 0 {
+		minSamples = DefaultHedgeMinSamples
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.Percentile <= 0 || len(o.samples) < minSamples {
+		return o.Delay
+	}
+
+	sorted := append([]time.Duration(nil), o.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted))*o.Percentile+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// observe keeps the latency of a successful response
+func (o *HedgeOptions) observe(latency time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.samples) < hedgeSamples {
+		o.samples = append(o.samples, latency)
+		return
+	}
+	o.samples[o.next] = latency
+	o.next = (o.next + 1) % hedgeSamples
+}
+
+// earn adds the budget of a request
+func (o *HedgeOptions) earn() {
+	budget := o.Budget
+	if budget <= 0 {
+		budget = DefaultHedgeBudget
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.started {
+		o.tokens, o.started = hedgeBurst, true
+	}
+	o.tokens += budget
+	if o.tokens > hedgeBurst {
+		o.tokens = hedgeBurst
+	}
+}
+
+// spend takes the budget of a hedge, false when exhausted
+func (o *HedgeOptions) spend() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.tokens < 1 {
+		return false
+	}
+	o.tokens--
+	return true
+}
+
+// hedgeable reports whether req is an idempotent request without body
+func hedgeable(req *http.Request) bool {
+	return (req.Method == http.MethodGet || req.Method == http.MethodHead) &&
+		(req.Body == nil || req.Body == http.NoBody) && req.Header.Get("Upgrade") == ""
+}
+
+// hedgeResult is the result of an attempt
+type hedgeResult struct {
+	resp    *http.Response
+	err     error
+	attempt int
+	latency time.Duration
+	cancel  context.CancelFunc
+}
+
+// success reports whether the result can be used without waiting the others
+func (r hedgeResult) success() bool {
+	return r.err == nil && r.resp.StatusCode < http.StatusInternalServerError
+}
+
+// hedge returns send hedging the requests allowed by o
+func (o *HedgeOptions) hedge(send sendFunc) sendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		if !hedgeable(req) {
+			return send(req)
+		}
+		atomic.AddInt64(&o.requests, 1)
+		o.earn()
+
+		delay := o.delay()
+		if delay <= 0 {
+			start := time.Now()
+			resp, err := send(req)
+			if o.Percentile > 0 && (hedgeResult{resp: resp, err: err}).success() {
+				o.observe(time.Since(start))
+			}
+			return resp, err
+		}
+
+		hosts := make([]*url.URL, 0, len(o.Hosts))
+		for _, host := range o.Hosts {
+			u, err := url.Parse(host)
+			if err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid hedge host %q", host)
+			}
+			hosts = append(hosts, u)
+		}
+
+		maxHedges := o.MaxHedges
+		if maxHedges <= 0 {
+			maxHedges = 1
+		}
+
+		results := make(chan hedgeResult, maxHedges+1)
+		cancels := make([]context.CancelFunc, 0, maxHedges+1)
+		launch := func(attempt int) {
+			r := req
+			if attempt > 0 && len(hosts) > 0 {
+				r = withBaseURL(req, hosts[(attempt-1)%len(hosts)])
+			}
+			ctx, cancel := context.WithCancel(req.Context())
+			cancels = append(cancels, cancel)
+			r = r.Clone(ctx)
+
+			start := time.Now()
+			go func() {
+				resp, err := send(r)
+				results <- hedgeResult{resp: resp, err: err, attempt: attempt, latency: time.Since(start), cancel: cancel}
+			}()
+		}
+
+		launch(0)
+		pending := 1
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		var last *hedgeResult
+		for {
+			select {
+			case <-timer.C:
+				if len(cancels) <= maxHedges && o.spend() {
+					atomic.AddInt64(&o.hedges, 1)
+					if info := infoFromContext(req.Context()); info != nil {
+						atomic.AddInt64(&info.hedges, 1)
+					}
+					launch(len(cancels))
+					pending++
+					timer.Reset(delay)
+				}
+
+			case r := <-results:
+				pending--
+				if r.success() {
+					o.observe(r.latency)
+					if r.attempt > 0 {
+						atomic.AddInt64(&o.wins, 1)
+						if info := infoFromContext(req.Context()); info != nil {
+							atomic.StoreInt32(&info.hedgeWon, 1)
+						}
+					}
+					for i, cancel := range cancels {
+						if i != r.attempt {
+							cancel()
+						}
+					}
+					if last != nil {
+						last.discard()
+					}
+					go discardResults(results, pending)
+					return r.result()
+				}
+
+				// responses are preferred to errors when every attempt fails
+				if last == nil || last.resp == nil && r.resp != nil {
+					if last != nil {
+						last.discard()
+					}
+					last = &r
+				} else {
+					r.discard()
+				}
+				if pending == 0 {
+					return last.result()
+				}
+			}
+		}
+	}
+}
+
+// result returns the response, its body cancels the attempt when closed
+func (r hedgeResult) result() (*http.Response, error) {
+	if r.err != nil {
+		r.cancel()
+		return nil, r.err
+	}
+	if r.resp.Body == nil {
+		r.cancel()
+		return r.resp, nil
+	}
+	r.resp.Body = &cancelBody{ReadCloser: r.resp.Body, cancel: r.cancel}
+	return r.resp, nil
+}
+
+// discard closes the response of a losing attempt
+func (r hedgeResult) discard() {
+	if r.resp != nil && r.resp.Body != nil {
+		_ = r.resp.Body.Close()
+	}
+	r.cancel()
+}
+
+// discardResults discards the results of attempts still running
+func discardResults(results <-chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		(<-results).discard()
+	}
+}
+
+// withBaseURL returns a shallow copy of req sent to the scheme and host of base,
+// the path of base prefixes the path of req
+func withBaseURL(req *http.Request, base *url.URL) *http.Request {
+	r := req.WithContext(req.Context())
+	u := *req.URL
+	u.Scheme, u.Host = base.Scheme, base.Host
+	if base.Path != "" && base.Path != "/" {
+		u.Path = strings.TrimSuffix(base.Path, "/") + u.Path
+		u.RawPath = ""
+	}
+	r.URL = &u
+	r.Host = ""
+	return r
+}
+
+// cancelBody calls cancel when closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
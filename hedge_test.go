@@ -0,0 +1,187 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgeOptions_Hedge(t *testing.T) {
+	var calls int32
+	canceled := make(chan struct{}, 1)
+	slow := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1)%2 == 1 && r.Method != http.MethodPost {
+			select {
+			case <-r.Context().Done():
+				canceled <- struct{}{}
+				return
+			case <-time.After(2 * time.Second):
+			}
+		}
+		fmt.Fprint(w, "slow")
+	})
+	defer slow.Close()
+
+	replica := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "replica"+r.URL.Path)
+	})
+	defer replica.Close()
+
+	tests := []struct {
+		desc   string
+		method string
+		hosts  []string
+		output string
+		stats  HedgeStats
+	}{
+		{desc: "SameHost", method: http.MethodGet, output: "slow", stats: HedgeStats{Requests: 1, Hedges: 1, Wins: 1}},
+		{desc: "OtherHost", method: http.MethodGet, hosts: []string{replica.URL}, output: "replica/path", stats: HedgeStats{Requests: 1, Hedges: 1, Wins: 1}},
+		{desc: "NotIdempotent", method: http.MethodPost, output: "slow"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			hedge := &HedgeOptions{Delay: 50 * time.Millisecond, Hosts: test.hosts}
+			opt := DefaultOptions()
+			opt.Hedge = hedge
+
+			req, _ := NewRequest(test.method, slow.URL+"/path", nil)
+			start := time.Now()
+			rsp, err := New(opt).Do(req)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Expected hedge response, but waited [%s]", elapsed)
+			}
+			if stats := hedge.Stats(); stats != test.stats {
+				t.Errorf("Expected [%+v], but got [%+v]", test.stats, stats)
+			}
+			if test.stats.Wins == 0 {
+				return
+			}
+
+			select {
+			case <-canceled:
+			case <-time.After(time.Second):
+				t.Error("Expected slow request canceled, but it's still running")
+			}
+		})
+	}
+}
+
+func TestHedgeOptions_Fast(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, "fast")
+	})
+	defer s.Close()
+
+	metrics := &Metrics{}
+	hedge := &HedgeOptions{Delay: time.Second}
+	opt := DefaultOptions()
+	opt.Hedge = hedge
+	opt.Metrics = metrics
+	f := New(opt)
+
+	for _, path := range []string{"/ok", "/fail"} {
+		rsp, err := f.Get(s.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if output := rsp.String(); output != "fast" {
+			t.Errorf("Expected [fast], but got [%s]", output)
+		}
+	}
+
+	if stats := hedge.Stats(); stats != (HedgeStats{Requests: 2}) {
+		t.Errorf("Expected no hedge, but got [%+v]", stats)
+	}
+	var out strings.Builder
+	_, _ = metrics.WriteTo(&out)
+	line := fmt.Sprintf(`fetch_hedges_total{method="GET",host="%s",route="other"} 0`, strings.TrimPrefix(s.URL, "http://"))
+	if !strings.Contains(out.String(), line) {
+		t.Errorf("Expected [%s], but got [%s]", line, out.String())
+	}
+}
+
+func TestHedgeOptions_Budget(t *testing.T) {
+	hedge := &HedgeOptions{Budget: 0.5}
+	hedge.earn()
+	for i := 0; i < hedgeBurst; i++ {
+		if !hedge.spend() {
+			t.Fatalf("Expected burst of [%d] hedges, but got [%d]", hedgeBurst, i)
+		}
+	}
+	if hedge.spend() {
+		t.Error("Expected budget exhausted, but got a hedge")
+	}
+
+	hedge.earn()
+	hedge.earn()
+	if !hedge.spend() || hedge.spend() {
+		t.Error("Expected one hedge earned by two requests")
+	}
+}
+
+func TestHedgeOptions_Percentile(t *testing.T) {
+	hedge := &HedgeOptions{Delay: time.Second, Percentile: 0.95}
+	for i := 1; i <= 100; i++ {
+		if i == DefaultHedgeMinSamples {
+			if delay := hedge.delay(); delay != time.Second {
+				t.Errorf("Expected static delay before [%d] samples, but got [%s]", DefaultHedgeMinSamples, delay)
+			}
+		}
+		hedge.observe(time.Duration(i) * time.Millisecond)
+	}
+
+	if delay := hedge.delay(); delay != 95*time.Millisecond {
+		t.Errorf("Expected [95ms], but got [%s]", delay)
+	}
+}
+
+func TestHedgeOptions_PercentileWithoutDelay(t *testing.T) {
+	var calls int32
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		// the first requests are fast, the next one is slow until hedged
+		if atomic.AddInt32(&calls, 1) == 6 {
+			time.Sleep(500 * time.Millisecond)
+		}
+		fmt.Fprint(w, "ok")
+	})
+	defer s.Close()
+
+	hedge := &HedgeOptions{Percentile: 0.9, MinSamples: 5}
+	opt := DefaultOptions()
+	opt.Hedge = hedge
+	f := New(opt)
+
+	for i := 0; i < 5; i++ {
+		if _, err := f.Get(s.URL, nil); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+	}
+	if delay := hedge.delay(); delay <= 0 {
+		t.Fatalf("Expected delay from the latencies, but got [%s]", delay)
+	}
+
+	rsp, err := f.Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "ok" {
+		t.Errorf("Expected [ok], but got [%s]", output)
+	}
+	if stats := hedge.Stats(); stats != (HedgeStats{Requests: 6, Hedges: 1, Wins: 1}) {
+		t.Errorf("Expected hedged request, but got [%+v]", stats)
+	}
+}
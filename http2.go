@@ -0,0 +1,87 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Protocol selects the HTTP version used by the transport created by New.
+type Protocol int
+
+const (
+	// ProtocolHTTP2 uses HTTP/2 when negotiated by TLS, HTTP/1.1 otherwise
+	ProtocolHTTP2 Protocol = iota
+	// ProtocolHTTP1 uses HTTP/1.1 only
+	ProtocolHTTP1
+	// ProtocolH2C uses HTTP/2 with prior knowledge for cleartext requests (h2c)
+	// and HTTP/2 negotiated by TLS for the others, it can't be used with Options.Proxy
+	ProtocolH2C
+)
+
+// HTTP2Options configure the HTTP/2 connections.
+type HTTP2Options struct {
+	// ReadIdleTimeout is the time without frames received after which
+	// a ping health check is sent, zero disables the health check.
+	ReadIdleTimeout time.Duration
+	// PingTimeout is the time waiting the ping response before the
+	// connection is closed, 15 seconds by default.
+	PingTimeout time.Duration
+}
+
+// configureProtocol enable the protocol selected in transport
+func configureProtocol(transport *http.Transport, protocol Protocol, opt *HTTP2Options) (*http2.Transport, error) {
+	if protocol == ProtocolHTTP1 {
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return nil, nil
+	}
+
+	h2, err := http2.ConfigureTransports(transport)
+	if err != nil {
+		return nil, err
+	}
+
+	if opt != nil {
+		h2.ReadIdleTimeout = opt.ReadIdleTimeout
+		h2.PingTimeout = opt.PingTimeout
+	}
+
+	if protocol == ProtocolH2C {
+		h2c := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return transport.DialContext(ctx, network, addr)
+			},
+			ReadIdleTimeout: h2.ReadIdleTimeout,
+			PingTimeout:     h2.PingTimeout,
+		}
+		transport.RegisterProtocol("http", h2c)
+		return h2c, nil
+	}
+
+	return h2, nil
+}
+
+// Protocol returns the protocol of response as ALPN identifiers:
+// "h2", "h2c", "http/1.1" or "http/1.0".
+func (r *Response) Protocol() string {
+	if r.Response == nil || r.ProtoMajor == 0 {
+		return ""
+	}
+
+	switch {
+	case r.ProtoMajor == 2 && r.TLS == nil:
+		return "h2c"
+	case r.ProtoMajor == 2:
+		return "h2"
+	case r.ProtoMinor == 0:
+		return "http/1.0"
+	default:
+		return "http/1.1"
+	}
+}
@@ -0,0 +1,115 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProtocol(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	})
+
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	h2cServer := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer h2cServer.Close()
+
+	tests := []struct {
+		desc     string
+		protocol Protocol
+		server   *httptest.Server
+		output   string
+	}{
+		{desc: "HTTP2-TLS", protocol: ProtocolHTTP2, server: tlsServer, output: "h2"},
+		{desc: "HTTP2-Cleartext", protocol: ProtocolHTTP2, server: h2cServer, output: "http/1.1"},
+		{desc: "HTTP1-TLS", protocol: ProtocolHTTP1, server: tlsServer, output: "http/1.1"},
+		{desc: "H2C-Cleartext", protocol: ProtocolH2C, server: h2cServer, output: "h2c"},
+		{desc: "H2C-TLS", protocol: ProtocolH2C, server: tlsServer, output: "h2"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.Protocol = test.protocol
+			opt.TLS = &TLSOptions{CAPEM: serverCAPEM(tlsServer)}
+
+			rsp, err := New(opt).Get(test.server.URL, nil)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.Protocol(); output != test.output {
+				t.Errorf("Expected protocol [%s], but got [%s] (%s)", test.output, output, rsp.String())
+			}
+		})
+	}
+}
+
+func TestConfigureProtocol(t *testing.T) {
+	opt := &HTTP2Options{ReadIdleTimeout: 10 * time.Second, PingTimeout: 5 * time.Second}
+
+	for _, protocol := range []Protocol{ProtocolHTTP2, ProtocolH2C} {
+		h2, err := configureProtocol(&http.Transport{}, protocol, opt)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if h2.ReadIdleTimeout != opt.ReadIdleTimeout || h2.PingTimeout != opt.PingTimeout {
+			t.Errorf("Expected health check [%s/%s], but got [%s/%s]", opt.ReadIdleTimeout, opt.PingTimeout, h2.ReadIdleTimeout, h2.PingTimeout)
+		}
+	}
+
+	transport := &http.Transport{}
+	if h2, _ := configureProtocol(transport, ProtocolHTTP1, opt); h2 != nil || transport.TLSNextProto == nil {
+		t.Error("Expected HTTP/2 disabled, but got enabled")
+	}
+
+	if (&Response{}).Protocol() != "" {
+		t.Error("Expected empty protocol without response")
+	}
+}
+
+func TestProtocol_H2C(t *testing.T) {
+	t.Run("Test-Proxy", func(t *testing.T) {
+		opt := DefaultOptions()
+		opt.Protocol = ProtocolH2C
+		opt.Proxy = &ProxyOptions{URL: "http://127.0.0.1:3128"}
+
+		if _, err := New(opt).Get("http://127.0.0.1/", nil); err == nil {
+			t.Error("Expected proxy error, but got none error")
+		}
+	})
+
+	t.Run("Test-DialContext", func(t *testing.T) {
+		dialed := make(chan error, 1)
+		opt := DefaultOptions()
+		opt.Protocol = ProtocolH2C
+		opt.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			<-ctx.Done()
+			dialed <- ctx.Err()
+			return nil, ctx.Err()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if _, err := New(opt).GetWithContext(ctx, "http://127.0.0.1/", nil); err == nil {
+			t.Error("Expected canceled error, but got none error")
+		}
+
+		select {
+		case <-dialed:
+		case <-time.After(time.Second):
+			t.Error("Expected dial canceled with the request, but got still dialing")
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// requestInfoKey is the context key of requestInfo
+type requestInfoKey struct{}
+
+// requestInfo collects details of a request while it's sent,
+// it travels in the request context and is exposed by Response.
+type requestInfo struct {
+	// wireSize and decodedSize are the bytes of body read before and after
+	// decoding, first for 64-bit alignment of atomic operations
+	wireSize    int64
+	decodedSize int64
+	// retries is the number of times the request was sent again
+	retries int64
+	// hedges is the number of hedges sent, hedgeWon is 1 when a hedge
+	// response was used
+	hedges int64
+	// queueWait is the time in nanoseconds waiting in the bulkhead queue
+	queueWait int64
+	hedgeWon  int32
+
+	// headers is the time until the response headers, set before the
+	// Response is returned
+	headers time.Duration
+	// askedGzip is true when gzip was asked in place of http.Transport, set
+	// before the request is sent
+	askedGzip bool
+
+	mu sync.Mutex
+	// proxy is the URL of proxy used, nil for direct connections
+	proxy *url.URL
+	// encoding is the Content-Encoding of response
+	encoding string
+}
+
+// withRequestInfo returns a shallow copy of req carrying a new requestInfo
+func withRequestInfo(req *http.Request) (*http.Request, *requestInfo) {
+	info := &requestInfo{}
+	return req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info)), info
+}
+
+// infoFromContext returns the requestInfo of ctx or nil
+func infoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
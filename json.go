@@ -0,0 +1,63 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// GetJSON sends a GET request to url accepting JSON and decodes the body of the
+// response into T. Responses without 2xx status fail with a *StatusError, the
+// Response is returned with the error to inspect the body.
+func GetJSON[T any](ctx context.Context, f *Fetch, url string) (T, *Response, error) {
+	var value T
+	req, err := NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		rsp, err := newErrorResponse(http.StatusNoContent, "couldn't request GET: %s", err)
+		return value, rsp, err
+	}
+
+	return doJSON[T](ctx, f, req)
+}
+
+// PostJSON sends a POST request to url with in encoded as JSON and decodes the
+// body of the response into Out, as GetJSON.
+func PostJSON[In, Out any](ctx context.Context, f *Fetch, url string, in In) (Out, *Response, error) {
+	var value Out
+	body, err := json.Marshal(in)
+	if err != nil {
+		rsp, err := newErrorResponse(http.StatusNoContent, "couldn't encode body: %s", err)
+		return value, rsp, err
+	}
+
+	req, err := NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		rsp, err := newErrorResponse(http.StatusNoContent, "couldn't request POST: %s", err)
+		return value, rsp, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return doJSON[Out](ctx, f, req)
+}
+
+// doJSON sends req accepting JSON, checks the status and decodes the body into T,
+// a 204 No Content response returns the zero value of T
+func doJSON[T any](ctx context.Context, f *Fetch, req *http.Request) (T, *Response, error) {
+	var value T
+	req.Header.Set("Accept", "application/json")
+
+	rsp, err := f.DoWithContext(ctx, req)
+	if err != nil {
+		return value, rsp, err
+	}
+	if err := checkStatus(rsp); err != nil {
+		return value, rsp, err
+	}
+	if rsp.StatusCode == http.StatusNoContent {
+		return value, rsp, nil
+	}
+
+	err = rsp.Decode(&value)
+	return value, rsp, err
+}
@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func jsonMock(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Accept") != "application/json" {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/users":
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var user jsonUser
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		user.Age++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(user)
+	case "/users/1":
+		fmt.Fprint(w, `{"name":"Rodrigo","age":30}`)
+	case "/empty":
+		w.WriteHeader(http.StatusNoContent)
+	case "/invalid":
+		fmt.Fprint(w, `{"name":`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error":"not found"}`)
+	}
+}
+
+func TestGetJSON(t *testing.T) {
+	s := serverHandlerMock(jsonMock)
+	defer s.Close()
+
+	tests := []struct {
+		desc     string
+		path     string
+		expected jsonUser
+		status   int
+		err      bool
+	}{
+		{desc: "Decoded", path: "/users/1", expected: jsonUser{Name: "Rodrigo", Age: 30}, status: http.StatusOK},
+		{desc: "NoContent", path: "/empty", status: http.StatusNoContent},
+		{desc: "Invalid", path: "/invalid", status: http.StatusOK, err: true},
+		{desc: "NotFound", path: "/missing", status: http.StatusNotFound, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			user, rsp, err := GetJSON[jsonUser](context.Background(), NewDefault(), s.URL+test.path)
+			if test.err != (err != nil) {
+				t.Errorf("Expected error [%v], but got [%v]", test.err, err)
+			}
+			if user != test.expected {
+				t.Errorf("Expected [%+v], but got [%+v]", test.expected, user)
+			}
+			if rsp.StatusCode != test.status {
+				t.Errorf("Expected status [%d], but got [%d]", test.status, rsp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestGetJSON_StatusError(t *testing.T) {
+	s := serverHandlerMock(jsonMock)
+	defer s.Close()
+
+	_, _, err := GetJSON[jsonUser](context.Background(), NewDefault(), s.URL+"/missing")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Expected status error, but got [%v]", err)
+	}
+	if output := statusErr.Response.String(); output != `{"error":"not found"}` {
+		t.Errorf("Expected [%s], but got [%s]", `{"error":"not found"}`, output)
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	s := serverHandlerMock(jsonMock)
+	defer s.Close()
+
+	user, rsp, err := PostJSON[jsonUser, jsonUser](context.Background(), NewDefault(), s.URL+"/users", jsonUser{Name: "Rodrigo", Age: 30})
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if expected := (jsonUser{Name: "Rodrigo", Age: 31}); user != expected {
+		t.Errorf("Expected [%+v], but got [%+v]", expected, user)
+	}
+	if rsp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected status [%d], but got [%d]", http.StatusCreated, rsp.StatusCode)
+	}
+
+	if _, _, err := PostJSON[chan int, jsonUser](context.Background(), NewDefault(), s.URL+"/users", make(chan int)); err == nil {
+		t.Error("Expected encode error, but got none error")
+	}
+}
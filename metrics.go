@@ -0,0 +1,275 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMetricsNamespace prefixes the metric names when Metrics.Namespace is empty.
+const DefaultMetricsNamespace = "fetch"
+
+// OtherRoute is the route of requests not matching any template.
+const OtherRoute = "other"
+
+// DefaultBuckets are the latency buckets in seconds of Prometheus clients.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects the metrics of requests sent by Fetch and serves them in the
+// Prometheus text exposition format. It's safe for concurrent use.
+type Metrics struct {
+	// Namespace prefixes the metric names, DefaultMetricsNamespace when empty.
+	Namespace string
+	// Buckets are the upper bounds in seconds of latency histogram, DefaultBuckets when empty.
+	Buckets []float64
+	// Routes are the path templates used as route label, eg. /users/{id}/orders,
+	// where {name} matches a segment. Requests not matching are labeled OtherRoute.
+	Routes []string
+
+	mu       sync.Mutex
+	series   map[metricLabels]*metricSeries
+	inFlight int64
+}
+
+// metricLabels identify the series of a request
+type metricLabels struct {
+	method, host, route string
+}
+
+// metricSeries keeps the metrics of a label set
+type metricSeries struct {
+	// received is updated while response bodies are read
+	received int64
+
+	statuses  map[string]int64
+	buckets   []int64
+	sum       float64
+	count     int64
+	sent      int64
+	retries   int64
+	hedges    int64
+	hedgeWins int64
+	errors    int64
+}
+
+// routeKey is the context key of route template
+type routeKey struct{}
+
+// WithRoute returns a copy of ctx labeling its requests with the route template,
+// it takes precedence over Metrics.Routes.
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// route returns the route template of req
+func (m *Metrics) route(req *http.Request) string {
+	if route, ok := req.Context().Value(routeKey{}).(string); ok {
+		return route
+	}
+
+	path := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	for _, template := range m.Routes {
+		if matchRoute(strings.Split(strings.Trim(template, "/"), "/"), path) {
+			return template
+		}
+	}
+	return OtherRoute
+}
+
+// matchRoute reports whether the path segments match the template segments
+func matchRoute(template, path []string) bool {
+	if len(template) != len(path) {
+		return false
+	}
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") && path[i] != "" {
+			continue
+		}
+		if segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// begin starts the measure of req and returns the function ending it
+func (m *Metrics) begin(req *http.Request) func(resp *http.Response, err error, info *requestInfo) {
+	labels := metricLabels{method: req.Method, host: req.URL.Host, route: m.route(req)}
+	sent := req.ContentLength
+	start := time.Now()
+	atomic.AddInt64(&m.inFlight, 1)
+
+	return func(resp *http.Response, err error, info *requestInfo) {
+		elapsed := time.Since(start).Seconds()
+		atomic.AddInt64(&m.inFlight, -1)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		s := m.seriesOf(labels)
+		s.count++
+		s.sum += elapsed
+		for i, bound := range m.buckets() {
+			if elapsed <= bound {
+				s.buckets[i]++
+			}
+		}
+		if sent > 0 {
+			s.sent += sent
+		}
+		s.retries += atomic.LoadInt64(&info.retries)
+		s.hedges += atomic.LoadInt64(&info.hedges)
+		s.hedgeWins += int64(atomic.LoadInt32(&info.hedgeWon))
+
+		status := "error"
+		if err != nil {
+			s.errors++
+		} else {
+			status = strconv.Itoa(resp.StatusCode/100) + "xx"
+			if resp.Body != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+				resp.Body = &countingBody{ReadCloser: resp.Body, n: &s.received}
+			}
+		}
+		s.statuses[status]++
+	}
+}
+
+// seriesOf returns the series of labels, the caller holds mu
+func (m *Metrics) seriesOf(labels metricLabels) *metricSeries {
+	if m.series == nil {
+		m.series = map[metricLabels]*metricSeries{}
+	}
+	s, ok := m.series[labels]
+	if !ok {
+		s = &metricSeries{statuses: map[string]int64{}, buckets: make([]int64, len(m.buckets()))}
+		m.series[labels] = s
+	}
+	return s
+}
+
+// buckets returns the histogram buckets
+func (m *Metrics) buckets() []float64 {
+	if len(m.Buckets) == 0 {
+		return DefaultBuckets
+	}
+	return m.Buckets
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{Writer: bufio.NewWriter(w)}
+	ns := m.Namespace
+	if ns == "" {
+		ns = DefaultMetricsNamespace
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]metricLabels, 0, len(m.series))
+	for labels := range m.series {
+		keys = append(keys, labels)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.host != b.host {
+			return a.host < b.host
+		}
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		return a.method < b.method
+	})
+
+	writeHeader(cw, ns+"_requests_total", "counter", "Requests sent by method, host, route and status class.")
+	for _, labels := range keys {
+		statuses := make([]string, 0, len(m.series[labels].statuses))
+		for status := range m.series[labels].statuses {
+			statuses = append(statuses, status)
+		}
+		sort.Strings(statuses)
+		for _, status := range statuses {
+			fmt.Fprintf(cw, "%s_requests_total{%s,status=%q} %d\n", ns, labels, status, m.series[labels].statuses[status])
+		}
+	}
+
+	writeHeader(cw, ns+"_request_duration_seconds", "histogram", "Time until the response headers are received.")
+	for _, labels := range keys {
+		s := m.series[labels]
+		for i, bound := range m.buckets() {
+			fmt.Fprintf(cw, "%s_request_duration_seconds_bucket{%s,le=%q} %d\n", ns, labels, formatFloat(bound), s.buckets[i])
+		}
+		fmt.Fprintf(cw, "%s_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", ns, labels, s.count)
+		fmt.Fprintf(cw, "%s_request_duration_seconds_sum{%s} %s\n", ns, labels, formatFloat(s.sum))
+		fmt.Fprintf(cw, "%s_request_duration_seconds_count{%s} %d\n", ns, labels, s.count)
+	}
+
+	writeHeader(cw, ns+"_requests_in_flight", "gauge", "Requests waiting for the response headers.")
+	fmt.Fprintf(cw, "%s_requests_in_flight %d\n", ns, atomic.LoadInt64(&m.inFlight))
+
+	counters := []struct {
+		name, help string
+		value      func(s *metricSeries) int64
+	}{
+		{"request_bytes_total", "Bytes of request bodies with known size.", func(s *metricSeries) int64 { return s.sent }},
+		{"response_bytes_total", "Bytes of response bodies read.", func(s *metricSeries) int64 { return atomic.LoadInt64(&s.received) }},
+		{"retries_total", "Requests sent again after the first attempt.", func(s *metricSeries) int64 { return s.retries }},
+		{"hedges_total", "Hedges sent for slow requests.", func(s *metricSeries) int64 { return s.hedges }},
+		{"hedge_wins_total", "Requests answered by a hedge.", func(s *metricSeries) int64 { return s.hedgeWins }},
+		{"errors_total", "Requests failed without response.", func(s *metricSeries) int64 { return s.errors }},
+	}
+	for _, c := range counters {
+		writeHeader(cw, ns+"_"+c.name, "counter", c.help)
+		for _, labels := range keys {
+			fmt.Fprintf(cw, "%s_%s{%s} %d\n", ns, c.name, labels, c.value(m.series[labels]))
+		}
+	}
+
+	return cw.n, cw.Writer.(*bufio.Writer).Flush()
+}
+
+// String formats the labels for the exposition format.
+func (l metricLabels) String() string {
+	return fmt.Sprintf(`method="%s",host="%s",route="%s"`, escapeLabel(l.method), escapeLabel(l.host), escapeLabel(l.route))
+}
+
+// escapeLabel escapes backslashes, quotes and new lines of label values
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// formatFloat formats f as Prometheus clients
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// writeHeader writes the HELP and TYPE lines of metric
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// countingWriter counts the bytes written
+type countingWriter struct {
+	io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.n += int64(n)
+	return n, err
+}
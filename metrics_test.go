@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_Requests(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		fmt.Fprint(w, "hello")
+	})
+	defer s.Close()
+
+	metrics := &Metrics{Namespace: "test", Routes: []string{"/users/{id}", "/users/{id}/orders"}}
+	opt := DefaultOptions()
+	opt.Metrics = metrics
+	f := New(opt)
+
+	for _, path := range []string{"/users/1", "/users/2", "/users/3/orders", "/missing/1"} {
+		rsp, err := f.Get(s.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		_ = rsp.String()
+	}
+	rsp, err := f.PostWithContext(WithRoute(context.Background(), "/custom"), s.URL+"/anything", NewReader("body"))
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	_ = rsp.String()
+	_, _ = f.Get("http://127.0.0.1:1/unreachable", nil)
+
+	host := strings.TrimPrefix(s.URL, "http://")
+	var out strings.Builder
+	if _, err := metrics.WriteTo(&out); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	output := out.String()
+
+	tests := []struct {
+		desc string
+		line string
+	}{
+		{desc: "Route", line: fmt.Sprintf(`test_requests_total{method="GET",host="%s",route="/users/{id}",status="2xx"} 2`, host)},
+		{desc: "NestedRoute", line: fmt.Sprintf(`test_requests_total{method="GET",host="%s",route="/users/{id}/orders",status="2xx"} 1`, host)},
+		{desc: "OtherRoute", line: fmt.Sprintf(`test_requests_total{method="GET",host="%s",route="other",status="4xx"} 1`, host)},
+		{desc: "WithRoute", line: fmt.Sprintf(`test_requests_total{method="POST",host="%s",route="/custom",status="2xx"} 1`, host)},
+		{desc: "Error", line: `test_requests_total{method="GET",host="127.0.0.1:1",route="other",status="error"} 1`},
+		{desc: "ErrorsTotal", line: `test_errors_total{method="GET",host="127.0.0.1:1",route="other"} 1`},
+		{desc: "Histogram", line: fmt.Sprintf(`test_request_duration_seconds_bucket{method="GET",host="%s",route="/users/{id}",le="+Inf"} 2`, host)},
+		{desc: "Count", line: fmt.Sprintf(`test_request_duration_seconds_count{method="GET",host="%s",route="/users/{id}"} 2`, host)},
+		{desc: "Sent", line: fmt.Sprintf(`test_request_bytes_total{method="POST",host="%s",route="/custom"} 6`, host)},
+		{desc: "Received", line: fmt.Sprintf(`test_response_bytes_total{method="GET",host="%s",route="/users/{id}"} 10`, host)},
+		{desc: "InFlight", line: "test_requests_in_flight 0"},
+		{desc: "Type", line: "# TYPE test_request_duration_seconds histogram"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			if !strings.Contains(output, test.line+"\n") {
+				t.Errorf("Expected [%s], but got [%s]", test.line, output)
+			}
+		})
+	}
+}
+
+func TestMetrics_Retries(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", nonce="abc", qop="auth"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	defer s.Close()
+
+	metrics := &Metrics{}
+	opt := DefaultOptions()
+	opt.Auth = &DigestAuth{Username: "user", Password: "pass"}
+	opt.Metrics = metrics
+
+	if _, err := New(opt).Get(s.URL, nil); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Body)
+
+	line := fmt.Sprintf(`fetch_retries_total{method="GET",host="%s",route="other"} 1`, strings.TrimPrefix(s.URL, "http://"))
+	if !strings.Contains(string(body), line) {
+		t.Errorf("Expected [%s], but got [%s]", line, body)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Expected exposition content type, but got [%s]", ct)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if output := escapeLabel("a\\b\"c\nd"); output != `a\\b\"c\nd` {
+		t.Errorf("Expected [%s], but got [%s]", `a\\b\"c\nd`, output)
+	}
+}
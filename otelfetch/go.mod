@@ -0,0 +1,21 @@
+module github.com/rodkranz/fetch/otelfetch
+
+go 1.18
+
+require (
+	github.com/rodkranz/fetch v1.3.0
+	go.opentelemetry.io/otel v1.0.0
+	go.opentelemetry.io/otel/sdk v1.0.0
+	go.opentelemetry.io/otel/trace v1.0.0
+)
+
+require (
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
+
+// The parent directory is used during development, go get ignores replace
+// directives and resolves the version required: v1.3.0 of fetch is tagged
+// first, then otelfetch/v1.3.0 on the same commit.
+replace github.com/rodkranz/fetch => ../
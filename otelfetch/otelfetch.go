@@ -0,0 +1,108 @@
+// Package otelfetch adapts OpenTelemetry tracers to fetch.Tracer, so the
+// client spans of Fetch are exported by the OpenTelemetry SDK.
+//
+//	opt := fetch.DefaultOptions()
+//	opt.Tracer = otelfetch.NewTracer(otel.Tracer("fetch"))
+package otelfetch
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rodkranz/fetch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracer returns a fetch.Tracer starting client spans with tracer.
+func NewTracer(tracer trace.Tracer) fetch.Tracer {
+	return &otelTracer{tracer: tracer}
+}
+
+// otelTracer implements fetch.Tracer
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// Start starts a client span, the parent is the OpenTelemetry span of ctx or
+// the span context set with fetch.ContextWithSpanContext.
+func (t *otelTracer) Start(ctx context.Context, name string) (context.Context, fetch.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		if sc := fetch.SpanContextFromContext(ctx); sc.IsValid() {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, toOTel(sc))
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+	return ctx, &otelSpan{span: span}
+}
+
+// otelSpan implements fetch.Span
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s *otelSpan) SpanContext() fetch.SpanContext {
+	return fromOTel(s.span.SpanContext())
+}
+
+func (s *otelSpan) SetAttributes(attrs ...fetch.Attribute) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, toAttribute(attr))
+	}
+	s.span.SetAttributes(kvs...)
+}
+
+func (s *otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// toAttribute converts attr, values of unknown types are formatted as strings
+func toAttribute(attr fetch.Attribute) attribute.KeyValue {
+	switch v := attr.Value.(type) {
+	case string:
+		return attribute.String(attr.Key, v)
+	case int:
+		return attribute.Int(attr.Key, v)
+	case int64:
+		return attribute.Int64(attr.Key, v)
+	case bool:
+		return attribute.Bool(attr.Key, v)
+	default:
+		return attribute.String(attr.Key, fmt.Sprint(v))
+	}
+}
+
+// toOTel converts a fetch span context, an invalid tracestate is dropped
+func toOTel(sc fetch.SpanContext) trace.SpanContext {
+	config := trace.SpanContextConfig{
+		TraceID: trace.TraceID(sc.TraceID),
+		SpanID:  trace.SpanID(sc.SpanID),
+		Remote:  sc.Remote,
+	}
+	if sc.Sampled {
+		config.TraceFlags = trace.FlagsSampled
+	}
+	if state, err := trace.ParseTraceState(sc.TraceState); err == nil {
+		config.TraceState = state
+	}
+	return trace.NewSpanContext(config)
+}
+
+// fromOTel converts an OpenTelemetry span context
+func fromOTel(sc trace.SpanContext) fetch.SpanContext {
+	return fetch.SpanContext{
+		TraceID:    fetch.TraceID(sc.TraceID()),
+		SpanID:     fetch.SpanID(sc.SpanID()),
+		Sampled:    sc.IsSampled(),
+		TraceState: sc.TraceState().String(),
+		Remote:     sc.IsRemote(),
+	}
+}
@@ -0,0 +1,96 @@
+package otelfetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rodkranz/fetch"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewTracer(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Traceparent"), r.Header.Get("Tracestate"))
+	}))
+	defer s.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	opt := fetch.DefaultOptions()
+	opt.Tracer = NewTracer(provider.Tracer("fetch"))
+	f := fetch.New(opt)
+
+	incoming := http.Header{}
+	incoming.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set("Tracestate", "congo=t61rcWkgMzE")
+
+	tests := []struct {
+		desc   string
+		ctx    context.Context
+		path   string
+		status codes.Code
+	}{
+		{desc: "FetchParent", ctx: fetch.ExtractTraceContext(context.Background(), incoming), path: "/ok", status: codes.Unset},
+		{desc: "Failed", ctx: fetch.ExtractTraceContext(context.Background(), incoming), path: "/fail", status: codes.Error},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			exporter.Reset()
+			rsp, err := f.GetWithContext(test.ctx, s.URL+test.path, nil)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("Expected [1] span, but got [%d]", len(spans))
+			}
+			span := spans[0]
+			if span.Parent.SpanID().String() != "00f067aa0ba902b7" || span.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("Expected child of incoming trace, but got parent [%s]", span.Parent.SpanID())
+			}
+			if span.SpanKind != trace.SpanKindClient || span.Status.Code != test.status {
+				t.Errorf("Expected client span with status [%s], but got [%s] [%s]", test.status, span.SpanKind, span.Status.Code)
+			}
+
+			expected := fmt.Sprintf("00-%s-%s-01|congo=t61rcWkgMzE", span.SpanContext.TraceID(), span.SpanContext.SpanID())
+			if output := rsp.String(); output != expected {
+				t.Errorf("Expected [%s], but got [%s]", expected, output)
+			}
+
+			attrs := map[attribute.Key]attribute.Value{}
+			for _, kv := range span.Attributes {
+				attrs[kv.Key] = kv.Value
+			}
+			if attrs["http.method"].AsString() != "GET" || attrs["http.url"].AsString() != s.URL+test.path {
+				t.Errorf("Expected method and URL attributes, but got [%v]", span.Attributes)
+			}
+		})
+	}
+
+	t.Run("Test-OTelParent", func(t *testing.T) {
+		exporter.Reset()
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "parent")
+		if _, err := f.GetWithContext(ctx, s.URL, nil); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		parent.End()
+
+		spans := exporter.GetSpans()
+		if len(spans) != 2 || spans[0].Parent.SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected child of [%s], but got [%d] spans", parent.SpanContext().SpanID(), len(spans))
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package fetch
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the minimum time between two progress updates.
+const DefaultProgressInterval = 100 * time.Millisecond
+
+// Progress is a snapshot of a body transfer.
+type Progress struct {
+	// Done is the number of bytes transferred.
+	Done int64
+	// Total is the size of body, -1 when unknown.
+	Total int64
+	// Rate is the average bytes per second since the transfer started.
+	Rate float64
+	// ETA is the estimated time to finish, zero when unknown.
+	ETA time.Duration
+	// Finished is true in the last update, sent when the body ends.
+	Finished bool
+}
+
+// ProgressFunc receives the updates of a transfer, it's called by the
+// goroutine reading the body.
+type ProgressFunc func(Progress)
+
+// ProgressChan returns a ProgressFunc which sends the updates to ch,
+// updates are dropped while ch is full so transfers are never blocked.
+func ProgressChan(ch chan<- Progress) ProgressFunc {
+	return func(p Progress) {
+		select {
+		case ch <- p:
+		default:
+		}
+	}
+}
+
+// ProgressOptions configure the progress reported for request and response bodies.
+type ProgressOptions struct {
+	// Upload receives the progress of request bodies.
+	Upload ProgressFunc
+	// Download receives the progress of response bodies.
+	Download ProgressFunc
+	// Interval is the minimum time between updates, DefaultProgressInterval when zero.
+	// The last update is always sent.
+	Interval time.Duration
+}
+
+// progressKey is the context key of ProgressOptions
+type progressKey struct{}
+
+// WithProgress returns a copy of ctx reporting the progress of requests sent with it,
+// it takes precedence over Options.Progress.
+func WithProgress(ctx context.Context, opt *ProgressOptions) context.Context {
+	return context.WithValue(ctx, progressKey{}, opt)
+}
+
+// progressOptions returns the ProgressOptions of ctx or of Options
+func (f *Fetch) progressOptions(ctx context.Context) *ProgressOptions {
+	if opt, ok := ctx.Value(progressKey{}).(*ProgressOptions); ok {
+		return opt
+	}
+	return f.Option.Progress
+}
+
+// trackUpload wraps the body of req to report its progress
+func (opt *ProgressOptions) trackUpload(req *http.Request) {
+	if opt == nil || opt.Upload == nil || req.Body == nil || req.Body == http.NoBody {
+		return
+	}
+
+	total := requestSize(req)
+	req.Body = newProgressReader(req.Body, total, opt.Upload, opt.Interval)
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return newProgressReader(body, total, opt.Upload, opt.Interval), nil
+		}
+	}
+}
+
+// trackDownload wraps the body of resp to report its progress
+func (opt *ProgressOptions) trackDownload(resp *http.Response) {
+	// the body of switching protocols is the connection itself
+	if opt == nil || opt.Download == nil || resp == nil || resp.Body == nil || resp.StatusCode == http.StatusSwitchingProtocols {
+		return
+	}
+
+	total := resp.ContentLength
+	if total < 0 {
+		total = -1
+	}
+	resp.Body = newProgressReader(resp.Body, total, opt.Download, opt.Interval)
+}
+
+// requestSize returns the size of request body, files are measured
+// when ContentLength is unknown
+func requestSize(req *http.Request) int64 {
+	if req.ContentLength > 0 {
+		return req.ContentLength
+	}
+
+	if file, ok := req.Body.(interface {
+		io.Seeker
+		Stat() (os.FileInfo, error)
+	}); ok {
+		info, err := file.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - offset
+	}
+	return -1
+}
+
+// progressReader reports the bytes read from ReadCloser
+type progressReader struct {
+	io.ReadCloser
+	fn       ProgressFunc
+	interval time.Duration
+
+	mu       sync.Mutex
+	total    int64
+	done     int64
+	start    time.Time
+	last     time.Time
+	finished bool
+}
+
+func newProgressReader(body io.ReadCloser, total int64, fn ProgressFunc, interval time.Duration) *progressReader {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &progressReader{ReadCloser: body, fn: fn, interval: interval, total: total}
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	r.mu.Lock()
+	now := time.Now()
+	if r.start.IsZero() {
+		r.start = now
+	}
+	r.done += int64(n)
+
+	finished := err == io.EOF || r.total >= 0 && r.done >= r.total
+	if r.finished || !finished && now.Sub(r.last) < r.interval {
+		r.mu.Unlock()
+		return n, err
+	}
+	r.last, r.finished = now, finished
+	progress := r.progress(now)
+	r.mu.Unlock()
+
+	r.fn(progress)
+	return n, err
+}
+
+// progress returns the snapshot at now, the caller holds mu
+func (r *progressReader) progress(now time.Time) Progress {
+	p := Progress{Done: r.done, Total: r.total, Finished: r.finished}
+
+	if elapsed := now.Sub(r.start).Seconds(); elapsed > 0 {
+		p.Rate = float64(r.done) / elapsed
+	}
+	if p.Rate > 0 && r.total >= 0 && !r.finished {
+		p.ETA = time.Duration(float64(r.total-r.done) / p.Rate * float64(time.Second))
+	}
+	return p
+}
@@ -0,0 +1,158 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// progressRecorder keeps the updates received
+type progressRecorder struct {
+	mu      sync.Mutex
+	updates []Progress
+}
+
+func (r *progressRecorder) record(p Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates = append(r.updates, p)
+}
+
+func (r *progressRecorder) last() (Progress, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.updates) == 0 {
+		return Progress{}, 0
+	}
+	return r.updates[len(r.updates)-1], len(r.updates)
+}
+
+func TestProgress_Upload(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(ioutil.Discard, r.Body)
+		fmt.Fprint(w, n)
+	})
+	defer s.Close()
+
+	file, err := ioutil.TempFile("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, _ = file.WriteString(strings.Repeat("f", 300000))
+	_, _ = file.Seek(0, io.SeekStart)
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		part, _ := mw.CreateFormFile("file", "data.txt")
+		_, _ = part.Write([]byte(strings.Repeat("m", 200000)))
+		_ = mw.Close()
+		_ = pw.Close()
+	}()
+
+	tests := []struct {
+		desc  string
+		body  io.Reader
+		total int64
+	}{
+		{desc: "NewReader", body: NewReader(strings.Repeat("a", 500000)), total: 500002},
+		{desc: "File", body: file, total: 300000},
+		{desc: "Multipart", body: pr, total: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			recorder := &progressRecorder{}
+			opt := DefaultOptions()
+			opt.Progress = &ProgressOptions{Upload: recorder.record, Interval: time.Hour}
+
+			rsp, err := New(opt).Post(s.URL, test.body)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			sent := rsp.String()
+
+			last, count := recorder.last()
+			if !last.Finished || fmt.Sprint(last.Done) != sent || last.Total != test.total {
+				t.Errorf("Expected finished [%s/%d], but got [%+v]", sent, test.total, last)
+			}
+			// the first read and the last one, the interval drops the others
+			if count != 2 {
+				t.Errorf("Expected [2] updates, but got [%d]", count)
+			}
+		})
+	}
+}
+
+func TestProgress_Download(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100000")
+		fmt.Fprint(w, strings.Repeat("d", 100000))
+	})
+	defer s.Close()
+
+	recorder := &progressRecorder{}
+	opt := DefaultOptions()
+	opt.Progress = &ProgressOptions{Download: recorder.record}
+	f := New(opt)
+
+	ch := make(chan Progress, 1000)
+	ctx := WithProgress(context.Background(), &ProgressOptions{Download: ProgressChan(ch), Interval: time.Nanosecond})
+	rsp, err := f.GetWithContext(ctx, s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if _, err := rsp.Bytes(); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	close(ch)
+
+	var last Progress
+	for p := range ch {
+		if p.Done < last.Done {
+			t.Errorf("Expected increasing progress, but got [%d] after [%d]", p.Done, last.Done)
+		}
+		last = p
+	}
+	if !last.Finished || last.Done != 100000 || last.Total != 100000 || last.ETA != 0 {
+		t.Errorf("Expected finished [100000/100000], but got [%+v]", last)
+	}
+	if _, count := recorder.last(); count != 0 {
+		t.Errorf("Expected context options used, but got [%d] updates in Options", count)
+	}
+
+	rsp, err = f.Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	_ = rsp.String()
+	if last, _ := recorder.last(); !last.Finished || last.Done != 100000 {
+		t.Errorf("Expected finished [100000], but got [%+v]", last)
+	}
+}
+
+func TestProgressReader_Rate(t *testing.T) {
+	now := time.Now()
+	r := newProgressReader(ioutil.NopCloser(strings.NewReader("")), 1000, func(Progress) {}, 0)
+	r.start, r.done = now.Add(-2*time.Second), 250
+
+	p := r.progress(now)
+	if p.Rate != 125 || p.ETA != 6*time.Second {
+		t.Errorf("Expected rate [125] and ETA [6s], but got [%f] and [%s]", p.Rate, p.ETA)
+	}
+
+	r.total = -1
+	if p := r.progress(now); p.ETA != 0 {
+		t.Errorf("Expected unknown ETA, but got [%s]", p.ETA)
+	}
+}
@@ -0,0 +1,256 @@
+package fetch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// proxyServer is a HTTP proxy supporting CONNECT which records the requests received
+type proxyServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+	auth     []string
+}
+
+func newProxyServer() *proxyServer {
+	p := &proxyServer{}
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serve))
+	return p
+}
+
+func (p *proxyServer) serve(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	p.requests = append(p.requests, r.Method+" "+r.Host)
+	p.auth = append(p.auth, r.Header.Get("Proxy-Authorization"))
+	p.mu.Unlock()
+
+	if r.Method != http.MethodConnect {
+		r.RequestURI = ""
+		r.Header.Del("Proxy-Authorization")
+		resp, err := http.DefaultTransport.RoundTrip(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	pipe(conn, upstream)
+}
+
+// pipe copy data in both directions and close connections when done
+func pipe(a, b net.Conn) {
+	go func() {
+		_, _ = io.Copy(a, b)
+		a.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(b, a)
+		b.Close()
+	}()
+}
+
+// socks5Server accept SOCKS5 CONNECT without authentication and returns its address
+func socks5Server(t *testing.T, connects *int32) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			buf := make([]byte, 262)
+			// greeting: version, number of methods and methods
+			if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+				conn.Close()
+				continue
+			}
+			_, _ = io.ReadFull(conn, buf[:buf[1]])
+			_, _ = conn.Write([]byte{5, 0})
+
+			// request: version, command, reserved, address type
+			_, _ = io.ReadFull(conn, buf[:4])
+			var host string
+			switch buf[3] {
+			case 1:
+				_, _ = io.ReadFull(conn, buf[:4])
+				host = net.IP(buf[:4]).String()
+			case 3:
+				_, _ = io.ReadFull(conn, buf[:1])
+				n := int(buf[0])
+				_, _ = io.ReadFull(conn, buf[:n])
+				host = string(buf[:n])
+			}
+			_, _ = io.ReadFull(conn, buf[:2])
+			port := binary.BigEndian.Uint16(buf[:2])
+
+			upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+			if err != nil {
+				_, _ = conn.Write([]byte{5, 1, 0, 1, 0, 0, 0, 0, 0, 0})
+				conn.Close()
+				continue
+			}
+			atomic.AddInt32(connects, 1)
+			_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+			pipe(conn, upstream)
+		}
+	}()
+	return l
+}
+
+func TestProxyOptions_HTTP(t *testing.T) {
+	target := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "target")
+	})
+	defer target.Close()
+
+	p := newProxyServer()
+	defer p.Close()
+
+	opt := DefaultOptions()
+	opt.Proxy = &ProxyOptions{URL: strings.Replace(p.URL, "http://", "http://user:pass@", 1)}
+
+	rsp, err := New(opt).Get(target.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "target" {
+		t.Errorf("Expected [target], but got [%s]", output)
+	}
+	if len(p.requests) != 1 || p.requests[0] != "GET "+target.Listener.Addr().String() {
+		t.Errorf("Expected request through proxy, but got [%v]", p.requests)
+	}
+	if len(p.auth) != 1 || p.auth[0] != "Basic dXNlcjpwYXNz" {
+		t.Errorf("Expected proxy credentials, but got [%v]", p.auth)
+	}
+	if used := rsp.Proxy(); used == nil || used.String() != p.URL {
+		t.Errorf("Expected proxy [%s], but got [%v]", p.URL, used)
+	}
+}
+
+func TestProxyOptions_CONNECT(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	defer target.Close()
+
+	p := newProxyServer()
+	defer p.Close()
+
+	opt := DefaultOptions()
+	opt.TLS = &TLSOptions{CAPEM: serverCAPEM(target)}
+	opt.Proxy = &ProxyOptions{URL: p.URL}
+
+	rsp, err := New(opt).Get(target.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "secure" {
+		t.Errorf("Expected [secure], but got [%s]", output)
+	}
+	if len(p.requests) != 1 || p.requests[0] != "CONNECT "+target.Listener.Addr().String() {
+		t.Errorf("Expected CONNECT through proxy, but got [%v]", p.requests)
+	}
+}
+
+func TestProxyOptions_SOCKS5(t *testing.T) {
+	target := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "socks")
+	})
+	defer target.Close()
+
+	var connects int32
+	l := socks5Server(t, &connects)
+	defer l.Close()
+
+	opt := DefaultOptions()
+	opt.Proxy = &ProxyOptions{URL: "socks5://" + l.Addr().String()}
+
+	rsp, err := New(opt).Get(target.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "socks" {
+		t.Errorf("Expected [socks], but got [%s]", output)
+	}
+	if connects := atomic.LoadInt32(&connects); connects != 1 {
+		t.Errorf("Expected [1] SOCKS5 connect, but got [%d]", connects)
+	}
+	if used := rsp.Proxy(); used == nil || used.Scheme != "socks5" {
+		t.Errorf("Expected socks5 proxy, but got [%v]", used)
+	}
+}
+
+func TestProxyOptions_Rules(t *testing.T) {
+	target := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "target")
+	})
+	defer target.Close()
+
+	p := newProxyServer()
+	defer p.Close()
+
+	opt := DefaultOptions()
+	opt.Proxy = &ProxyOptions{
+		URL: "http://127.0.0.1:1",
+		Rules: []ProxyRule{
+			{Host: "local*", Proxy: p.URL},
+			{Host: "127.0.0.*", Proxy: ProxyDirect},
+		},
+	}
+	f := New(opt)
+
+	rsp, err := f.Get(target.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if used := rsp.Proxy(); used != nil {
+		t.Errorf("Expected direct connection, but got [%v]", used)
+	}
+
+	rsp, err = f.Get(strings.Replace(target.URL, "127.0.0.1", "localhost", 1), nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if used := rsp.Proxy(); used == nil || used.String() != p.URL {
+		t.Errorf("Expected proxy [%s], but got [%v]", p.URL, used)
+	}
+	if len(p.requests) != 1 {
+		t.Errorf("Expected [1] request through proxy, but got [%v]", p.requests)
+	}
+
+	opt = DefaultOptions()
+	opt.Proxy = &ProxyOptions{URL: "ftp://proxy"}
+	if _, err := New(opt).Get(target.URL, nil); err == nil {
+		t.Error("Expected unsupported scheme error, but got none error")
+	}
+}
@@ -0,0 +1,180 @@
+package fetch
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultMaxRedirects is the number of redirects followed when RedirectPolicy.MaxHops is zero
+const DefaultMaxRedirects = 10
+
+var (
+	// ErrRedirectLimit returns when the response redirects more than RedirectPolicy.MaxHops times
+	ErrRedirectLimit = errors.New("too many redirects")
+	// ErrRedirectHost returns when RedirectPolicy.SameHost is set and the response redirects to another host
+	ErrRedirectHost = errors.New("redirect to another host")
+	// ErrRedirectBody returns when the method is kept but the body can't be sent again
+	ErrRedirectBody = errors.New("redirect body can't be rewound")
+)
+
+// RedirectMethod defines the method used after a redirect.
+type RedirectMethod int
+
+const (
+	// RedirectMethodDefault switch to GET after 301, 302 and 303, 307 and 308 keep method and body
+	RedirectMethodDefault RedirectMethod = iota
+	// RedirectMethodKeep keep method and body for every status
+	RedirectMethodKeep
+	// RedirectMethodGet switch to GET for every status
+	RedirectMethodGet
+)
+
+// RedirectAuth defines when authentication headers are sent after a redirect.
+type RedirectAuth int
+
+const (
+	// RedirectAuthSameDomain keep them while redirected to the same domain or its subdomains
+	RedirectAuthSameDomain RedirectAuth = iota
+	// RedirectAuthSameHost keep them while redirected to the same host
+	RedirectAuthSameHost
+	// RedirectAuthKeep always keep them
+	RedirectAuthKeep
+	// RedirectAuthStrip never send them after a redirect
+	RedirectAuthStrip
+)
+
+// RedirectPolicy controls how redirects are followed.
+type RedirectPolicy struct {
+	// MaxHops is the maximum of redirects followed, DefaultMaxRedirects when zero
+	// and none redirect is followed when negative, the 3xx response is returned.
+	MaxHops int
+	// SameHost refuse redirects to another host.
+	SameHost bool
+
+	Method RedirectMethod
+	Auth   RedirectAuth
+	// AuthHeaders lists headers handled as Authorization, for example "X-Api-Key".
+	AuthHeaders []string
+}
+
+// Redirect is a response which redirected the request.
+type Redirect struct {
+	URL        *url.URL
+	StatusCode int
+	Header     http.Header
+}
+
+// Location returns the Location header of redirect.
+func (r Redirect) Location() string {
+	return r.Header.Get("Location")
+}
+
+// checkRedirect is used as http.Client.CheckRedirect
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	limit := p.MaxHops
+	switch {
+	case limit < 0:
+		return http.ErrUseLastResponse
+	case limit == 0:
+		limit = DefaultMaxRedirects
+	}
+
+	if len(via) > limit {
+		return ErrRedirectLimit
+	}
+
+	first, prev := via[0], via[len(via)-1]
+	if p.SameHost && req.URL.Host != first.URL.Host {
+		return ErrRedirectHost
+	}
+
+	if err := p.rewriteMethod(req, prev); err != nil {
+		return err
+	}
+
+	keep := p.keepAuth(first.URL, req.URL)
+	for _, name := range append([]string{"Authorization"}, p.AuthHeaders...) {
+		if values, ok := first.Header[http.CanonicalHeaderKey(name)]; ok && keep {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+			continue
+		}
+		req.Header.Del(name)
+	}
+
+	return nil
+}
+
+// rewriteMethod apply the method policy in request built by http.Client
+func (p *RedirectPolicy) rewriteMethod(req, prev *http.Request) error {
+	switch p.Method {
+	case RedirectMethodKeep:
+		if req.Method == prev.Method {
+			return nil
+		}
+
+		req.Method = prev.Method
+		if prev.GetBody == nil {
+			if prev.Body != nil && prev.Body != http.NoBody {
+				return ErrRedirectBody
+			}
+			return nil
+		}
+
+		body, err := prev.GetBody()
+		if err != nil {
+			return err
+		}
+		req.Body, req.GetBody, req.ContentLength = body, prev.GetBody, prev.ContentLength
+		if contentType := prev.Header.Get("Content-Type"); contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	case RedirectMethodGet:
+		if req.Method != http.MethodHead {
+			req.Method = http.MethodGet
+		}
+
+		// http.Client adds the body of first request again after 307 and 308
+		if req.Body != nil {
+			_ = req.Body.Close()
+			req.Body, req.GetBody, req.ContentLength = nil, nil, 0
+			req.Header.Del("Content-Type")
+		}
+	}
+
+	return nil
+}
+
+// keepAuth returns if authentication headers are sent from src to dst
+func (p *RedirectPolicy) keepAuth(src, dst *url.URL) bool {
+	switch p.Auth {
+	case RedirectAuthKeep:
+		return true
+	case RedirectAuthStrip:
+		return false
+	case RedirectAuthSameHost:
+		return src.Host == dst.Host
+	default:
+		s, d := strings.ToLower(src.Hostname()), strings.ToLower(dst.Hostname())
+		return s == d || strings.HasSuffix(d, "."+s)
+	}
+}
+
+// Redirects returns the redirect responses received before the final response,
+// from the first to the last.
+func (r *Response) Redirects() []Redirect {
+	if r.Response == nil {
+		return nil
+	}
+
+	var chain []Redirect
+	for req := r.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		redirect := Redirect{StatusCode: req.Response.StatusCode, Header: req.Response.Header}
+		if req.Response.Request != nil {
+			redirect.URL = req.Response.Request.URL
+		}
+		chain = append([]Redirect{redirect}, chain...)
+	}
+	return chain
+}
@@ -0,0 +1,174 @@
+package fetch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// redirectServer redirects /0 to /1 and so on until /hops which answer method and body
+func redirectServer(status, hops int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var hop int
+		fmt.Sscanf(r.URL.Path, "/%d", &hop)
+		if hop < hops {
+			w.Header().Set("X-Hop", fmt.Sprint(hop))
+			http.Redirect(w, r, fmt.Sprintf("/%d", hop+1), status)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, body, r.Header.Get("X-Api-Key"))
+	}
+}
+
+func TestResponse_Redirects(t *testing.T) {
+	s := serverHandlerMock(redirectServer(http.StatusMovedPermanently, 3))
+	defer s.Close()
+
+	rsp, err := NewDefault().Get(s.URL+"/0", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	redirects := rsp.Redirects()
+	if len(redirects) != 3 {
+		t.Fatalf("Expected [3] redirects, but got [%d]", len(redirects))
+	}
+	for i, redirect := range redirects {
+		if redirect.URL.Path != fmt.Sprintf("/%d", i) {
+			t.Errorf("Expected URL [/%d], but got [%s]", i, redirect.URL.Path)
+		}
+		if redirect.StatusCode != http.StatusMovedPermanently {
+			t.Errorf("Expected status code [%d], but got [%d]", http.StatusMovedPermanently, redirect.StatusCode)
+		}
+		if redirect.Location() != fmt.Sprintf("/%d", i+1) || redirect.Header.Get("X-Hop") != fmt.Sprint(i) {
+			t.Errorf("Expected headers of hop [%d], but got [%v]", i, redirect.Header)
+		}
+	}
+
+	direct, err := NewDefault().Get(s.URL+"/3", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if redirects := direct.Redirects(); len(redirects) != 0 {
+		t.Errorf("Expected none redirect, but got [%v]", redirects)
+	}
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	t.Run("Test-MaxHops", func(t *testing.T) {
+		s := serverHandlerMock(redirectServer(http.StatusFound, 3))
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Redirect = &RedirectPolicy{MaxHops: 2}
+		if _, err := New(opt).Get(s.URL+"/0", nil); err == nil || !strings.Contains(err.Error(), ErrRedirectLimit.Error()) {
+			t.Errorf("Expected error [%s], but got [%v]", ErrRedirectLimit, err)
+		}
+
+		opt.Redirect.MaxHops = 3
+		if _, err := New(opt).Get(s.URL+"/0", nil); err != nil {
+			t.Errorf("Expected none error, but got [%s]", err)
+		}
+	})
+
+	t.Run("Test-NoRedirect", func(t *testing.T) {
+		s := serverHandlerMock(redirectServer(http.StatusFound, 3))
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Redirect = &RedirectPolicy{MaxHops: -1}
+		rsp, err := New(opt).Get(s.URL+"/0", nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if rsp.StatusCode != http.StatusFound {
+			t.Errorf("Expected status code [%d], but got [%d]", http.StatusFound, rsp.StatusCode)
+		}
+	})
+
+	t.Run("Test-SameHost", func(t *testing.T) {
+		target := serverHandlerMock(redirectServer(http.StatusFound, 0))
+		defer target.Close()
+		s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+		})
+		defer s.Close()
+
+		opt := DefaultOptions()
+		opt.Redirect = &RedirectPolicy{SameHost: true}
+		if _, err := New(opt).Get(s.URL, nil); err == nil || !strings.Contains(err.Error(), ErrRedirectHost.Error()) {
+			t.Errorf("Expected error [%s], but got [%v]", ErrRedirectHost, err)
+		}
+	})
+
+	tests := []struct {
+		desc   string
+		status int
+		method RedirectMethod
+		output string
+	}{
+		{desc: "Default-302", status: http.StatusFound, method: RedirectMethodDefault, output: "GET  "},
+		{desc: "Default-307", status: http.StatusTemporaryRedirect, method: RedirectMethodDefault, output: `POST "body" `},
+		{desc: "Keep-302", status: http.StatusFound, method: RedirectMethodKeep, output: `POST "body" `},
+		{desc: "Get-308", status: http.StatusPermanentRedirect, method: RedirectMethodGet, output: "GET  "},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-Method-%s", test.desc), func(t *testing.T) {
+			s := serverHandlerMock(redirectServer(test.status, 2))
+			defer s.Close()
+
+			opt := DefaultOptions()
+			opt.Redirect = &RedirectPolicy{Method: test.method}
+			rsp, err := New(opt).Post(s.URL+"/0", NewReader("body"))
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicy_Auth(t *testing.T) {
+	target := serverHandlerMock(redirectServer(http.StatusFound, 0))
+	defer target.Close()
+
+	// 127.0.0.1 redirects to localhost which is another domain
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	})
+	defer s.Close()
+
+	tests := []struct {
+		desc   string
+		auth   RedirectAuth
+		output string
+	}{
+		{desc: "SameDomain", auth: RedirectAuthSameDomain, output: "GET  "},
+		{desc: "SameHost", auth: RedirectAuthSameHost, output: "GET  "},
+		{desc: "Keep", auth: RedirectAuthKeep, output: "GET  key"},
+		{desc: "Strip", auth: RedirectAuthStrip, output: "GET  "},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.Auth = APIKeyAuth{Name: "X-Api-Key", Value: "key"}
+			opt.Redirect = &RedirectPolicy{Auth: test.auth, AuthHeaders: []string{"X-Api-Key"}}
+
+			rsp, err := New(opt).Get(s.URL, nil)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+		})
+	}
+}
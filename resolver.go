@@ -0,0 +1,404 @@
+package fetch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultFallbackDelay is the delay before the next address is tried by SelectHappyEyeballs
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// Resolver resolves host names into addresses, *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// TTLResolver is a Resolver which knows how long the addresses are valid.
+type TTLResolver interface {
+	Resolver
+	LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error)
+}
+
+// AddressSelection defines how the addresses resolved are tried.
+type AddressSelection int
+
+const (
+	// SelectInOrder try the addresses in the order returned
+	SelectInOrder AddressSelection = iota
+	// SelectRoundRobin start from the next address on each connection
+	SelectRoundRobin
+	// SelectHappyEyeballs alternate IPv6 and IPv4 and race the connections (RFC 8305)
+	SelectHappyEyeballs
+)
+
+// ResolverOptions configure how the dialer of transport created by New resolves hosts.
+type ResolverOptions struct {
+	// Hosts overrides the resolution like curl --resolve, keys are "host" or "host:port"
+	// and values are IP addresses.
+	Hosts map[string][]string
+	// Resolver is used for hosts not overridden, net.DefaultResolver when nil.
+	Resolver Resolver
+	// CacheTTL is the maximum time addresses are cached, the record TTL is respected
+	// when Resolver is a TTLResolver. Zero disables the cache.
+	CacheTTL time.Duration
+
+	Selection AddressSelection
+	// FallbackDelay used by SelectHappyEyeballs, DefaultFallbackDelay when zero.
+	FallbackDelay time.Duration
+}
+
+// resolvingDialer dial connections resolving hosts with ResolverOptions
+type resolvingDialer struct {
+	opt    *ResolverOptions
+	dialer *net.Dialer
+	hosts  map[string][]net.IPAddr
+
+	mu    sync.Mutex
+	cache map[string]dnsCacheEntry
+	next  map[string]int
+}
+
+// dnsCacheEntry is an address list cached until expires
+type dnsCacheEntry struct {
+	addrs   []net.IPAddr
+	expires time.Time
+}
+
+// newResolvingDialer validate options and returns the dialer
+func newResolvingDialer(opt *ResolverOptions, dialer *net.Dialer) (*resolvingDialer, error) {
+	d := &resolvingDialer{
+		opt:    opt,
+		dialer: dialer,
+		hosts:  map[string][]net.IPAddr{},
+		cache:  map[string]dnsCacheEntry{},
+		next:   map[string]int{},
+	}
+
+	for host, ips := range opt.Hosts {
+		for _, ip := range ips {
+			parsed := net.ParseIP(ip)
+			if parsed == nil {
+				return nil, fmt.Errorf("invalid address %q for host %s", ip, host)
+			}
+			d.hosts[strings.ToLower(host)] = append(d.hosts[strings.ToLower(host)], net.IPAddr{IP: parsed})
+		}
+	}
+	return d, nil
+}
+
+// DialContext is used as http.Transport.DialContext
+func (d *resolvingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.lookup(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	switch d.opt.Selection {
+	case SelectRoundRobin:
+		addrs = d.rotate(host, addrs)
+	case SelectHappyEyeballs:
+		return d.race(ctx, network, port, interleave(addrs))
+	}
+
+	var firstErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// lookup returns the addresses of host from overrides, cache or resolver
+func (d *resolvingDialer) lookup(ctx context.Context, host, port string) ([]net.IPAddr, error) {
+	host = strings.ToLower(host)
+	if addrs, ok := d.hosts[net.JoinHostPort(host, port)]; ok {
+		return addrs, nil
+	}
+	if addrs, ok := d.hosts[host]; ok {
+		return addrs, nil
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	entry, ok := d.cache[host]
+	d.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	var resolver Resolver = net.DefaultResolver
+	if d.opt.Resolver != nil {
+		resolver = d.opt.Resolver
+	}
+
+	ttl := d.opt.CacheTTL
+	var addrs []net.IPAddr
+	var err error
+	if r, ok := resolver.(TTLResolver); ok {
+		var recordTTL time.Duration
+		addrs, recordTTL, err = r.LookupIPAddrTTL(ctx, host)
+		if recordTTL < ttl {
+			ttl = recordTTL
+		}
+	} else {
+		addrs, err = resolver.LookupIPAddr(ctx, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+
+	if ttl > 0 {
+		d.mu.Lock()
+		d.cache[host] = dnsCacheEntry{addrs: addrs, expires: now.Add(ttl)}
+		d.mu.Unlock()
+	}
+	return addrs, nil
+}
+
+// rotate returns addrs starting from the next address of host
+func (d *resolvingDialer) rotate(host string, addrs []net.IPAddr) []net.IPAddr {
+	d.mu.Lock()
+	start := d.next[host] % len(addrs)
+	d.next[host] = start + 1
+	d.mu.Unlock()
+
+	rotated := make([]net.IPAddr, 0, len(addrs))
+	return append(append(rotated, addrs[start:]...), addrs[:start]...)
+}
+
+// race start a connection attempt every fallback delay, or sooner when
+// an attempt fails, the first connection established wins and the others are closed.
+func (d *resolvingDialer) race(ctx context.Context, network, port string, addrs []net.IPAddr) (net.Conn, error) {
+	delay := d.opt.FallbackDelay
+	if delay == 0 {
+		delay = DefaultFallbackDelay
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	dial := func(addr net.IPAddr) {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		results <- result{conn: conn, err: err}
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	go dial(addrs[0])
+	started, pending := 1, 1
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// close the connections established after the winner
+				go func(n int) {
+					for ; n > 0; n-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		case <-timer.C:
+		}
+
+		if started < len(addrs) {
+			go dial(addrs[started])
+			started++
+			pending++
+			// the timer may have fired while an error was received
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(delay)
+		}
+	}
+	return nil, firstErr
+}
+
+// interleave alternate IPv6 and IPv4 addresses starting with the family of the first one
+func interleave(addrs []net.IPAddr) []net.IPAddr {
+	var primary, secondary []net.IPAddr
+	isV4 := addrs[0].IP.To4() != nil
+	for _, addr := range addrs {
+		if (addr.IP.To4() != nil) == isV4 {
+			primary = append(primary, addr)
+		} else {
+			secondary = append(secondary, addr)
+		}
+	}
+
+	mixed := make([]net.IPAddr, 0, len(addrs))
+	for i := 0; i < len(primary) || i < len(secondary); i++ {
+		if i < len(primary) {
+			mixed = append(mixed, primary[i])
+		}
+		if i < len(secondary) {
+			mixed = append(mixed, secondary[i])
+		}
+	}
+	return mixed
+}
+
+// ErrDNSTruncated returns when the DNS answer doesn't fit in UDP message
+var ErrDNSTruncated = errors.New("dns answer truncated")
+
+// DNSResolver queries A and AAAA records from the DNS server Server ("host:port")
+// over UDP, unlike net.Resolver it reports the TTL of records.
+type DNSResolver struct {
+	Server string
+	// Timeout of each query, 5 seconds by default.
+	Timeout time.Duration
+}
+
+// LookupIPAddr implements Resolver.
+func (r *DNSResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, _, err := r.LookupIPAddrTTL(ctx, host)
+	return addrs, err
+}
+
+// LookupIPAddrTTL implements TTLResolver, the TTL is the lowest of records.
+func (r *DNSResolver) LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var addrs []net.IPAddr
+	var ttl uint32
+	var ttlSet bool
+	var firstErr error
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeAAAA, dnsmessage.TypeA} {
+		answers, err := r.query(ctx, name, qtype)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		for _, answer := range answers {
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, net.IPAddr{IP: net.IP(body.A[:])})
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, net.IPAddr{IP: net.IP(body.AAAA[:])})
+			default:
+				continue
+			}
+			// a record with TTL zero must not be cached, whatever the other records say
+			if !ttlSet || answer.Header.TTL < ttl {
+				ttl, ttlSet = answer.Header.TTL, true
+			}
+		}
+	}
+
+	if len(addrs) == 0 {
+		if firstErr != nil {
+			return nil, 0, firstErr
+		}
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, Server: r.Server}
+	}
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+// query send a question to server and returns the answers
+func (r *DNSResolver) query(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, err
+	}
+
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", r.Server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 1232)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		var answer dnsmessage.Message
+		if err := answer.Unpack(buf[:n]); err != nil || answer.ID != msg.ID || !answer.Response {
+			continue
+		}
+		switch {
+		case answer.Truncated:
+			return nil, ErrDNSTruncated
+		case answer.RCode == dnsmessage.RCodeNameError:
+			return nil, &net.DNSError{Err: "no such host", Name: name.String(), Server: r.Server}
+		case answer.RCode != dnsmessage.RCodeSuccess:
+			return nil, &net.DNSError{Err: fmt.Sprintf("server answered %v", answer.RCode), Name: name.String(), Server: r.Server}
+		}
+		return answer.Answers, nil
+	}
+}
@@ -0,0 +1,264 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeResolver returns addrs with ttl and count the lookups
+type fakeResolver struct {
+	mu      sync.Mutex
+	addrs   []net.IPAddr
+	ttl     time.Duration
+	lookups int
+}
+
+func (r *fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, _, err := r.LookupIPAddrTTL(ctx, host)
+	return addrs, err
+}
+
+func (r *fakeResolver) LookupIPAddrTTL(ctx context.Context, host string) ([]net.IPAddr, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lookups++
+	return r.addrs, r.ttl, nil
+}
+
+// dnsServer answers A questions with a record of 127.0.0.x for each ttl and returns its address
+func dnsServer(t *testing.T, queries *int32, ttls ...uint32) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			atomic.AddInt32(queries, 1)
+
+			msg.Response = true
+			if msg.Questions[0].Type == dnsmessage.TypeA {
+				for i, ttl := range ttls {
+					msg.Answers = append(msg.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: msg.Questions[0].Name, Class: dnsmessage.ClassINET, TTL: ttl},
+						Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, byte(i + 1)}},
+					})
+				}
+			}
+			packed, _ := msg.Pack()
+			_, _ = conn.WriteTo(packed, addr)
+		}
+	}()
+	return conn
+}
+
+func TestResolverOptions_Hosts(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	})
+	defer s.Close()
+	port := s.Listener.Addr().(*net.TCPAddr).Port
+
+	opt := DefaultOptions()
+	opt.Resolver = &ResolverOptions{Hosts: map[string][]string{
+		"api.fetch.test":                        {"127.0.0.1"},
+		fmt.Sprintf("port.fetch.test:%d", port): {"127.0.0.1"},
+	}}
+	f := New(opt)
+
+	for _, host := range []string{"api.fetch.test", "port.fetch.test"} {
+		url := fmt.Sprintf("http://%s:%d/", host, port)
+		rsp, err := f.Get(url, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if output := rsp.String(); !strings.HasPrefix(output, host) {
+			t.Errorf("Expected host [%s], but got [%s]", host, output)
+		}
+	}
+
+	opt = DefaultOptions()
+	opt.Resolver = &ResolverOptions{Hosts: map[string][]string{"api.fetch.test": {"localhost"}}}
+	if _, err := New(opt).Get(s.URL, nil); err == nil {
+		t.Error("Expected invalid address error, but got none error")
+	}
+}
+
+func TestResolverOptions_Cache(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {})
+	defer s.Close()
+	url := strings.Replace(s.URL, "127.0.0.1", "cache.fetch.test", 1)
+
+	tests := []struct {
+		desc    string
+		ttl     time.Duration
+		cache   time.Duration
+		lookups int
+	}{
+		{desc: "Cached", ttl: time.Hour, cache: time.Minute, lookups: 1},
+		{desc: "RecordTTL", ttl: 0, cache: time.Minute, lookups: 3},
+		{desc: "Disabled", ttl: time.Hour, cache: 0, lookups: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			resolver := &fakeResolver{addrs: []net.IPAddr{{IP: net.ParseIP("127.0.0.1")}}, ttl: test.ttl}
+
+			opt := DefaultOptions()
+			opt.Resolver = &ResolverOptions{Resolver: resolver, CacheTTL: test.cache}
+			f := New(opt)
+
+			for i := 0; i < 3; i++ {
+				if _, err := f.Get(url, nil); err != nil {
+					t.Fatalf("Expected none error, but got [%s]", err)
+				}
+				f.Option.Transport.CloseIdleConnections()
+			}
+
+			if resolver.lookups != test.lookups {
+				t.Errorf("Expected [%d] lookups, but got [%d]", test.lookups, resolver.lookups)
+			}
+		})
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	var queries int32
+	conn := dnsServer(t, &queries, 60)
+	defer conn.Close()
+
+	resolver := &DNSResolver{Server: conn.LocalAddr().String(), Timeout: time.Second}
+	addrs, ttl, err := resolver.LookupIPAddrTTL(context.Background(), "stand-in.fetch.test")
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if len(addrs) != 1 || !addrs[0].IP.Equal(net.ParseIP("127.0.0.1")) {
+		t.Errorf("Expected [127.0.0.1], but got [%v]", addrs)
+	}
+	if ttl != time.Minute {
+		t.Errorf("Expected TTL [%s], but got [%s]", time.Minute, ttl)
+	}
+
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {})
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.Resolver = &ResolverOptions{Resolver: resolver, CacheTTL: time.Hour}
+	f := New(opt)
+	for i := 0; i < 2; i++ {
+		if _, err := f.Get(strings.Replace(s.URL, "127.0.0.1", "stand-in.fetch.test", 1), nil); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		f.Option.Transport.CloseIdleConnections()
+	}
+
+	// A and AAAA for the lookup and for the first request only
+	if queries := atomic.LoadInt32(&queries); queries != 4 {
+		t.Errorf("Expected [4] queries, but got [%d]", queries)
+	}
+}
+
+func TestDNSResolver_ZeroTTL(t *testing.T) {
+	tests := []struct {
+		desc     string
+		ttls     []uint32
+		expected time.Duration
+	}{
+		{desc: "ZeroFirst", ttls: []uint32{0, 60}, expected: 0},
+		{desc: "ZeroLast", ttls: []uint32{60, 0}, expected: 0},
+		{desc: "Lowest", ttls: []uint32{120, 60}, expected: time.Minute},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var queries int32
+			conn := dnsServer(t, &queries, test.ttls...)
+			defer conn.Close()
+
+			resolver := &DNSResolver{Server: conn.LocalAddr().String(), Timeout: time.Second}
+			addrs, ttl, err := resolver.LookupIPAddrTTL(context.Background(), "stand-in.fetch.test")
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if len(addrs) != len(test.ttls) {
+				t.Errorf("Expected [%d] addresses, but got [%v]", len(test.ttls), addrs)
+			}
+			if ttl != test.expected {
+				t.Errorf("Expected TTL [%s], but got [%s]", test.expected, ttl)
+			}
+		})
+	}
+}
+
+func TestResolvingDialer_Selection(t *testing.T) {
+	addrs := []net.IPAddr{
+		{IP: net.ParseIP("10.0.0.1")},
+		{IP: net.ParseIP("10.0.0.2")},
+		{IP: net.ParseIP("::1")},
+		{IP: net.ParseIP("10.0.0.3")},
+		{IP: net.ParseIP("::2")},
+	}
+
+	t.Run("Test-RoundRobin", func(t *testing.T) {
+		d, _ := newResolvingDialer(&ResolverOptions{}, &net.Dialer{})
+		for i := 0; i < 6; i++ {
+			rotated := d.rotate("host", addrs)
+			if expected := addrs[i%len(addrs)]; !rotated[0].IP.Equal(expected.IP) {
+				t.Errorf("Expected [%s] first, but got [%s]", expected, rotated[0])
+			}
+		}
+	})
+
+	t.Run("Test-Interleave", func(t *testing.T) {
+		var output []string
+		for _, addr := range interleave(addrs) {
+			output = append(output, addr.String())
+		}
+		expected := "10.0.0.1 ::1 10.0.0.2 ::2 10.0.0.3"
+		if strings.Join(output, " ") != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, strings.Join(output, " "))
+		}
+	})
+
+	t.Run("Test-HappyEyeballs", func(t *testing.T) {
+		s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "connected")
+		})
+		defer s.Close()
+
+		// the first address never answers, the second one wins the race
+		opt := DefaultOptions()
+		opt.Resolver = &ResolverOptions{
+			Hosts:         map[string][]string{"race.fetch.test": {"192.0.2.1", "127.0.0.1"}},
+			Selection:     SelectHappyEyeballs,
+			FallbackDelay: 50 * time.Millisecond,
+		}
+
+		rsp, err := New(opt).Get(strings.Replace(s.URL, "127.0.0.1", "race.fetch.test", 1), nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if output := rsp.String(); output != "connected" {
+			t.Errorf("Expected [connected], but got [%s]", output)
+		}
+	})
+}
@@ -14,6 +14,7 @@ var ErrEmptyBody = fmt.Errorf("the body of response is empty")
 type Response struct {
 	*http.Response
 	body []byte
+	info *requestInfo
 }
 
 // BodyIsEmpty return if body is empty or not.
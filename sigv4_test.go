@@ -0,0 +1,150 @@
+package fetch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sigV4Test uses the credentials of the published SigV4 test suite
+var sigV4Test = SigV4Auth{
+	AccessKey: "AKIDEXAMPLE",
+	SecretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	Region:    "us-east-1",
+	Service:   "service",
+	Now:       func() time.Time { return time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC) },
+}
+
+func TestSigV4Auth_TestSuite(t *testing.T) {
+	tests := []struct {
+		desc      string
+		method    string
+		url       string
+		header    http.Header
+		body      io.Reader
+		service   string
+		signed    string
+		signature string
+	}{
+		{
+			desc:      "get-vanilla",
+			method:    http.MethodGet,
+			url:       "http://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			desc:      "post-vanilla",
+			method:    http.MethodPost,
+			url:       "http://example.amazonaws.com/",
+			signed:    "host;x-amz-date",
+			signature: "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			desc:      "get-vanilla-query-order-key-case",
+			method:    http.MethodGet,
+			url:       "http://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signed:    "host;x-amz-date",
+			signature: "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			desc:      "post-x-www-form-urlencoded",
+			method:    http.MethodPost,
+			url:       "http://example.amazonaws.com/",
+			header:    http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}},
+			body:      strings.NewReader("Param1=value1"),
+			signed:    "content-type;host;x-amz-date",
+			signature: "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+		{
+			desc:      "iam-list-users",
+			method:    http.MethodGet,
+			url:       "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			header:    http.Header{"Content-Type": []string{"application/x-www-form-urlencoded; charset=utf-8"}},
+			service:   "iam",
+			signed:    "content-type;host;x-amz-date",
+			signature: "5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.url, test.body)
+			for k, v := range test.header {
+				req.Header[k] = v
+			}
+
+			auth := sigV4Test
+			if test.service != "" {
+				auth.Service = test.service
+			}
+			if err := auth.Authenticate(req); err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+
+			expected := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/%s/aws4_request, SignedHeaders=%s, Signature=%s",
+				auth.Service, test.signed, test.signature)
+			if got := req.Header.Get("Authorization"); got != expected {
+				t.Errorf("Expected [%s], but got [%s]", expected, got)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("Expected X-Amz-Date [20150830T123600Z], but got [%s]", got)
+			}
+		})
+	}
+}
+
+func TestSigV4Auth_CanonicalURI(t *testing.T) {
+	tests := []struct {
+		service string
+		path    string
+		output  string
+	}{
+		{service: "service", path: "", output: "/"},
+		{service: "service", path: "/example/../", output: "/"},
+		{service: "service", path: "/example//path/", output: "/example/path/"},
+		{service: "service", path: "/example space/", output: "/example%20space/"},
+		{service: "s3", path: "/bucket//key", output: "/bucket//key"},
+	}
+
+	for i, test := range tests {
+		t.Run(fmt.Sprintf("Test-%d-%s", i, test.service), func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "http://example.amazonaws.com/", nil)
+			req.URL.Path = test.path
+
+			if got := (SigV4Auth{Service: test.service}).canonicalURI(req); got != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, got)
+			}
+		})
+	}
+}
+
+func TestSigV4Auth_UnsignedPayload(t *testing.T) {
+	var contentHash, authorization string
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		contentHash = r.Header.Get("X-Amz-Content-Sha256")
+		authorization = r.Header.Get("Authorization")
+	})
+	defer s.Close()
+
+	auth := sigV4Test
+	auth.UnsignedPayload = true
+	auth.SessionToken = "session"
+
+	opt := DefaultOptions()
+	opt.Auth = auth
+	if _, err := New(opt).Put(s.URL+"/bucket/key", io.MultiReader(strings.NewReader("stream"))); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	if contentHash != UnsignedPayload {
+		t.Errorf("Expected [%s], but got [%s]", UnsignedPayload, contentHash)
+	}
+	if !strings.Contains(authorization, "SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-amz-security-token,") {
+		t.Errorf("Expected signed headers with content hash and token, but got [%s]", authorization)
+	}
+}
@@ -0,0 +1,112 @@
+package fetch
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// SingleFlightOptions collapse concurrent identical GET and HEAD requests into a
+// single request, each caller gets its own Response with a copy of the body.
+// Requests are identical when method, URL, Authorization, Cookie, Range,
+// Accept-Encoding and Headers are equal. The response body is buffered in memory,
+// so large downloads shouldn't use it, and Server-Sent Events and WebSocket
+// requests are sent as is.
+type SingleFlightOptions struct {
+	// Headers are the request headers added to the key, eg. Accept.
+	Headers []string
+
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall is a request in flight shared by identical requests
+type flightCall struct {
+	done chan struct{}
+	req  *http.Request
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// keyHeaders are always part of the key, responses depend on them
+var keyHeaders = []string{"Authorization", "Cookie", "Range", "Accept-Encoding"}
+
+// key returns the key of req, false when req can't be shared
+func (o *SingleFlightOptions) key(req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead ||
+		req.Body != nil && req.Body != http.NoBody ||
+		req.Header.Get("Upgrade") != "" || strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		return "", false
+	}
+
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String() + " " + req.Host)
+	for _, headers := range [][]string{keyHeaders, o.Headers} {
+		for _, name := range headers {
+			key.WriteString("\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(req.Header[http.CanonicalHeaderKey(name)], ","))
+		}
+	}
+	return key.String(), true
+}
+
+// dedupe returns send sharing the response of identical requests in flight
+func (o *SingleFlightOptions) dedupe(send sendFunc) sendFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		key, ok := o.key(req)
+		if !ok {
+			return send(req)
+		}
+
+		o.mu.Lock()
+		if o.calls == nil {
+			o.calls = map[string]*flightCall{}
+		}
+		if c, ok := o.calls[key]; ok {
+			o.mu.Unlock()
+			select {
+			case <-c.done:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+
+			// the request shared was canceled by its caller, not by this one
+			if c.err != nil && c.req.Context().Err() != nil && req.Context().Err() == nil {
+				return send(req)
+			}
+			return c.response()
+		}
+
+		c := &flightCall{done: make(chan struct{}), req: req}
+		o.calls[key] = c
+		o.mu.Unlock()
+
+		c.resp, c.err = send(req)
+		if c.err == nil {
+			c.body, c.err = ioutil.ReadAll(c.resp.Body)
+			_ = c.resp.Body.Close()
+		}
+
+		o.mu.Lock()
+		delete(o.calls, key)
+		o.mu.Unlock()
+		close(c.done)
+
+		return c.response()
+	}
+}
+
+// response returns a copy of the response shared with its own body
+func (c *flightCall) response() (*http.Response, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	resp := *c.resp
+	resp.Header = c.resp.Header.Clone()
+	resp.Trailer = c.resp.Trailer.Clone()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(c.body))
+	return &resp, nil
+}
@@ -0,0 +1,123 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSingleFlightOptions(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		<-release
+		w.Header().Set("X-Call", fmt.Sprint(n))
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("Authorization"), r.Header.Get("Accept"))
+	})
+	defer s.Close()
+
+	tests := []struct {
+		desc    string
+		method  string
+		headers []http.Header
+		calls   int32
+	}{
+		{desc: "Identical", method: http.MethodGet, headers: []http.Header{{}, {}, {}, {}}, calls: 1},
+		{desc: "Authorization", method: http.MethodGet,
+			headers: []http.Header{{"Authorization": {"a"}}, {"Authorization": {"b"}}, {"Authorization": {"a"}}}, calls: 2},
+		{desc: "SelectedHeader", method: http.MethodGet,
+			headers: []http.Header{{"Accept": {"text/plain"}}, {"Accept": {"application/json"}}, {"Accept": {"text/plain"}}}, calls: 2},
+		{desc: "AcceptEncoding", method: http.MethodGet,
+			headers: []http.Header{{"Accept-Encoding": {"gzip"}}, {"Accept-Encoding": {"identity"}}, {"Accept-Encoding": {"gzip"}}}, calls: 2},
+		{desc: "Post", method: http.MethodPost, headers: []http.Header{{}, {}, {}}, calls: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			atomic.StoreInt32(&calls, 0)
+			release = make(chan struct{})
+
+			opt := DefaultOptions()
+			opt.SingleFlight = &SingleFlightOptions{Headers: []string{"accept"}}
+			f := New(opt)
+
+			var wg sync.WaitGroup
+			responses := make([]*Response, len(test.headers))
+			for i, header := range test.headers {
+				wg.Add(1)
+				go func(i int, header http.Header) {
+					defer wg.Done()
+					req, _ := NewRequest(test.method, s.URL, nil)
+					req.Header = header
+					responses[i], _ = f.Do(req)
+				}(i, header)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+			close(release)
+			wg.Wait()
+
+			if n := atomic.LoadInt32(&calls); n != test.calls {
+				t.Errorf("Expected [%d] calls, but got [%d]", test.calls, n)
+			}
+			for i, rsp := range responses {
+				expected := fmt.Sprintf("%s %s %s", test.method, test.headers[i].Get("Authorization"), test.headers[i].Get("Accept"))
+				if output := rsp.String(); output != expected {
+					t.Errorf("Expected [%s], but got [%s]", expected, output)
+				}
+			}
+
+			responses[0].Header.Set("X-Call", "changed")
+			if responses[1].Header.Get("X-Call") == "changed" {
+				t.Error("Expected independent headers, but got the same")
+			}
+		})
+	}
+}
+
+func TestSingleFlightOptions_Canceled(t *testing.T) {
+	var calls int32
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprint(w, "ok")
+	})
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.SingleFlight = &SingleFlightOptions{}
+	f := New(opt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := f.GetWithContext(ctx, s.URL, nil)
+		leader <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	follower := make(chan *Response, 1)
+	go func() {
+		rsp, _ := f.Get(s.URL, nil)
+		follower <- rsp
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-leader; err == nil {
+		t.Error("Expected canceled error, but got none error")
+	}
+	if output := (<-follower).String(); output != "ok" {
+		t.Errorf("Expected follower sent again [ok], but got [%s]", output)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("Expected [2] calls, but got [%d]", n)
+	}
+}
@@ -0,0 +1,252 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"sync"
+)
+
+// StreamError is an element of stream which couldn't be decoded,
+// Line is the line of body where the element starts.
+type StreamError struct {
+	Line int
+	Err  error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap returns the error of decoding.
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// StreamDecoder decodes the elements of a NDJSON, JSON Lines or JSON array body
+// one by one, the body is read only when the next element is requested.
+type StreamDecoder struct {
+	ctx    context.Context
+	body   io.ReadCloser
+	reader *bufio.Reader
+	lines  bool
+
+	// array mode
+	counter *lineCounter
+	dec     *json.Decoder
+	started bool
+
+	line int
+	err  error
+
+	once sync.Once
+	done chan struct{}
+}
+
+// DecodeStream returns a decoder of body elements. Bodies with NDJSON or
+// JSON Lines content type, or not starting with "[", are decoded line by line,
+// the others as the elements of a top-level JSON array.
+// The body is closed when ctx is done, the stream ends or Close is called.
+func (r *Response) DecodeStream(ctx context.Context) (*StreamDecoder, error) {
+	var body io.ReadCloser
+	switch {
+	case !r.BodyIsEmpty():
+		body = ioutil.NopCloser(bytes.NewReader(r.body))
+	case r.Response != nil && r.Response.Body != nil:
+		body = r.Body
+	default:
+		return nil, ErrEmptyBody
+	}
+
+	d := &StreamDecoder{
+		ctx:    ctx,
+		body:   body,
+		reader: bufio.NewReader(body),
+		done:   make(chan struct{}),
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); isLinesMediaType(mediaType) {
+		d.lines = true
+	}
+
+	// unblock the reading of body when ctx is done
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = d.Close()
+		case <-d.done:
+		}
+	}()
+
+	return d, nil
+}
+
+// isLinesMediaType reports whether mediaType is a newline-delimited JSON
+func isLinesMediaType(mediaType string) bool {
+	switch mediaType {
+	case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines":
+		return true
+	}
+	return false
+}
+
+// Decode stores the next element in v. It returns io.EOF when the stream ends,
+// a *StreamError when the element is invalid and the next one can still be decoded,
+// or the error which stopped the stream.
+func (d *StreamDecoder) Decode(v interface{}) error {
+	if err := d.ctx.Err(); err != nil {
+		return err
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	if !d.started {
+		d.started = true
+		if err := d.start(); err != nil {
+			return d.fail(err)
+		}
+	}
+
+	if d.lines {
+		return d.decodeLine(v)
+	}
+	return d.decodeElement(v)
+}
+
+// Line returns the line of the last element decoded.
+func (d *StreamDecoder) Line() int {
+	return d.line
+}
+
+// Close stops the stream and closes the body.
+func (d *StreamDecoder) Close() (err error) {
+	d.once.Do(func() {
+		close(d.done)
+		err = d.body.Close()
+	})
+	return err
+}
+
+// start skips the leading whitespaces and detects a JSON array
+func (d *StreamDecoder) start() error {
+	line := 1
+	for {
+		b, err := d.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b == '\n' {
+			line++
+		}
+		if isSpace(b) {
+			continue
+		}
+		_ = d.reader.UnreadByte()
+
+		if d.lines || b != '[' {
+			d.lines = true
+			d.line = line - 1
+			return nil
+		}
+
+		d.counter = &lineCounter{Reader: d.reader, lines: line - 1}
+		d.dec = json.NewDecoder(d.counter)
+		// consume the opening bracket
+		_, err = d.dec.Token()
+		return err
+	}
+}
+
+// decodeLine decodes the next non-blank line
+func (d *StreamDecoder) decodeLine(v interface{}) error {
+	for {
+		data, err := d.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(data) == 0) {
+			return d.fail(err)
+		}
+		d.line++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		if err := json.Unmarshal(data, v); err != nil {
+			return &StreamError{Line: d.line, Err: err}
+		}
+		return nil
+	}
+}
+
+// decodeElement decodes the next element of array
+func (d *StreamDecoder) decodeElement(v interface{}) error {
+	if !d.dec.More() {
+		// consume the closing bracket
+		if _, err := d.dec.Token(); err != nil {
+			return d.fail(&StreamError{Line: d.position(), Err: err})
+		}
+		return d.fail(io.EOF)
+	}
+
+	d.line = d.position()
+	if err := d.dec.Decode(v); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return &StreamError{Line: d.line, Err: err}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return d.fail(&StreamError{Line: d.line, Err: err})
+	}
+	return nil
+}
+
+// position returns the line of the next element in the array
+func (d *StreamDecoder) position() int {
+	buffered, _ := ioutil.ReadAll(d.dec.Buffered())
+	line := d.counter.lines - bytes.Count(buffered, []byte{'\n'}) + 1
+
+	// the separator and spaces before the element
+	for _, b := range buffered {
+		if b != ',' && !isSpace(b) {
+			break
+		}
+		if b == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+// fail stops the stream with err, context errors take precedence
+func (d *StreamDecoder) fail(err error) error {
+	_ = d.Close()
+	if ctxErr := d.ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	d.err = err
+	return err
+}
+
+// isSpace reports whether b is a JSON whitespace
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+// lineCounter counts the lines read from Reader
+type lineCounter struct {
+	io.Reader
+	lines int
+}
+
+func (c *lineCounter) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.lines += bytes.Count(p[:n], []byte{'\n'})
+	return n, err
+}
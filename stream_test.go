@@ -0,0 +1,160 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type streamItem struct {
+	ID int `json:"id"`
+}
+
+// decodeAll decodes every element of stream and returns them with the error which stopped it
+func decodeAll(d *StreamDecoder) (items []string, err error) {
+	for {
+		var item streamItem
+		switch err := d.Decode(&item).(type) {
+		case nil:
+			items = append(items, fmt.Sprintf("%d@%d", item.ID, d.Line()))
+		case *StreamError:
+			items = append(items, err.Error())
+			if d.err != nil {
+				return items, err
+			}
+		default:
+			if err == io.EOF {
+				return items, nil
+			}
+			return items, err
+		}
+	}
+}
+
+func TestResponse_DecodeStream(t *testing.T) {
+	tests := []struct {
+		desc        string
+		contentType string
+		body        string
+		output      string
+		err         bool
+	}{
+		{
+			desc:        "NDJSON",
+			contentType: "application/x-ndjson",
+			body:        "{\"id\":1}\n{\"id\":2}\r\n\n{\"id\":3}",
+			output:      "1@1 2@2 3@4",
+		},
+		{
+			desc:   "JSONLines",
+			body:   "\n{\"id\":1}\n{\"id\":\"two\"}\n{\"id\":3}\n",
+			output: "1@2 line 3: json: cannot unmarshal string into Go struct field streamItem.id of type int 3@4",
+		},
+		{
+			desc:   "InvalidLine",
+			body:   "{\"id\":1}\n{\"id\":\n{\"id\":3}\n",
+			output: "1@1 line 2: unexpected end of JSON input 3@3",
+		},
+		{
+			desc:        "Array",
+			contentType: "application/json",
+			body:        "[\n  {\"id\":1},\n  {\"id\":2}\n  ,{\"id\":3}\n]",
+			output:      "1@2 2@3 3@4",
+		},
+		{
+			desc:   "ArrayTypeError",
+			body:   "[{\"id\":1},\n{\"id\":\"two\"},\n{\"id\":3}]",
+			output: "1@1 line 2: json: cannot unmarshal string into Go struct field streamItem.id of type int 3@3",
+		},
+		{
+			desc:   "ArrayTruncated",
+			body:   "[{\"id\":1},\n{\"id\":2",
+			output: "1@1 line 2: unexpected EOF",
+			err:    true,
+		},
+		{
+			desc:        "NDJSONOfArrays",
+			contentType: "application/x-ndjson",
+			body:        "[1]\n",
+			output:      "line 1: json: cannot unmarshal array into Go value of type fetch.streamItem",
+		},
+		{
+			desc:   "Empty",
+			body:   "  \n",
+			output: "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+				if test.contentType != "" {
+					w.Header().Set("Content-Type", test.contentType)
+				}
+				fmt.Fprint(w, test.body)
+			})
+			defer s.Close()
+
+			rsp, err := NewDefault().Get(s.URL, nil)
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+
+			d, err := rsp.DecodeStream(context.Background())
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			defer d.Close()
+
+			items, err := decodeAll(d)
+			if (err != nil) != test.err {
+				t.Errorf("Expected error [%t], but got [%v]", test.err, err)
+			}
+			if output := strings.Join(items, " "); output != test.output {
+				t.Errorf("Expected [%s], but got [%s]", test.output, output)
+			}
+		})
+	}
+}
+
+func TestResponse_DecodeStreamCancel(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{\"id\":1}\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.Timeout = time.Minute
+	rsp, err := New(opt).Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d, err := rsp.DecodeStream(ctx)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	var item streamItem
+	if err := d.Decode(&item); err != nil || item.ID != 1 {
+		t.Fatalf("Expected item [1], but got [%d] [%v]", item.ID, err)
+	}
+
+	// the next element is never sent, cancel unblocks the reading
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if err := d.Decode(&item); err != context.Canceled {
+		t.Errorf("Expected [%s], but got [%v]", context.Canceled, err)
+	}
+
+	if _, err := (&Response{}).DecodeStream(ctx); err != ErrEmptyBody {
+		t.Errorf("Expected [%s], but got [%v]", ErrEmptyBody, err)
+	}
+}
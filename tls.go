@@ -0,0 +1,179 @@
+package fetch
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCertificatePin returns when none certificate of server matches the pinned keys
+var ErrCertificatePin = errors.New("none certificate matches the pinned public keys")
+
+// TLSOptions configure TLS of the transport created by New.
+type TLSOptions struct {
+	// CAFile and CAPEM are PEM bundles with the certificate authorities trusted,
+	// the system roots are used when both are empty or SystemRoots is set.
+	CAFile      string
+	CAPEM       []byte
+	SystemRoots bool
+
+	// CertFile and KeyFile is the client certificate for mutual TLS,
+	// the files are loaded again when they change.
+	CertFile string
+	KeyFile  string
+	// Certificates are static client certificates.
+	Certificates []tls.Certificate
+
+	// MinVersion is the minimum TLS version, tls.VersionTLS12 by default.
+	MinVersion uint16
+	// ServerName overrides the name sent by SNI and verified in the server certificate.
+	ServerName string
+	// PinnedSPKI lists base64 SHA-256 hashes of the SubjectPublicKeyInfo accepted,
+	// with or without "sha256/" prefix. The connection fails when none certificate matches.
+	PinnedSPKI []string
+}
+
+// Config build the tls.Config from options.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:   o.MinVersion,
+		ServerName:   o.ServerName,
+		Certificates: o.Certificates,
+	}
+	if cfg.MinVersion == 0 {
+		cfg.MinVersion = tls.VersionTLS12
+	}
+
+	roots, err := o.rootCAs()
+	if err != nil {
+		return nil, err
+	}
+	cfg.RootCAs = roots
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		reloader := &certReloader{certFile: o.CertFile, keyFile: o.KeyFile}
+		if _, err := reloader.certificate(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.certificate()
+		}
+	}
+
+	if len(o.PinnedSPKI) > 0 {
+		pins := make(map[string]bool, len(o.PinnedSPKI))
+		for _, pin := range o.PinnedSPKI {
+			pins[strings.TrimPrefix(pin, "sha256/")] = true
+		}
+		cfg.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			return verifyPins(pins, chains)
+		}
+	}
+
+	return cfg, nil
+}
+
+// rootCAs returns the pool with CAFile and CAPEM, nil means system roots
+func (o *TLSOptions) rootCAs() (*x509.CertPool, error) {
+	if o.CAFile == "" && len(o.CAPEM) == 0 {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+	if o.SystemRoots {
+		system, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		pool = system
+	}
+
+	bundles := [][]byte{o.CAPEM}
+	if o.CAFile != "" {
+		bs, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		bundles = append(bundles, bs)
+	}
+
+	for _, bundle := range bundles {
+		if len(bundle) > 0 && !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("none certificate found in CA bundle")
+		}
+	}
+	return pool, nil
+}
+
+// SPKIHash returns the base64 SHA-256 of certificate SubjectPublicKeyInfo as used by TLSOptions.PinnedSPKI.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPins check if any certificate of verified chains is pinned
+func verifyPins(pins map[string]bool, chains [][]*x509.Certificate) error {
+	for _, chain := range chains {
+		for _, cert := range chain {
+			if pins[SPKIHash(cert)] {
+				return nil
+			}
+		}
+	}
+	return ErrCertificatePin
+}
+
+// certReloader keep the client certificate and load it again when files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// certificate returns the client certificate loading it when files changed
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && modTime.Equal(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	r.cert, r.modTime = &cert, modTime
+	return r.cert, nil
+}
+
+// lastModified returns the most recent modification time of cert and key files
+func (r *certReloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return last, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
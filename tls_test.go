@@ -0,0 +1,166 @@
+package fetch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeClientCert generate a self signed certificate with common name cn in cert and key files
+func writeClientCert(t *testing.T, certFile, keyFile, cn string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Chtimes(certFile, modTime, modTime)
+	_ = os.Chtimes(keyFile, modTime, modTime)
+}
+
+func serverCAPEM(s *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+}
+
+func TestTLSOptions_CA(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.ServerName)
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(caFile, serverCAPEM(s), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		desc   string
+		tls    *TLSOptions
+		fail   bool
+		output string
+	}{
+		{desc: "SystemRoots", tls: &TLSOptions{}, fail: true},
+		{desc: "CAPEM", tls: &TLSOptions{CAPEM: serverCAPEM(s)}},
+		{desc: "CAFile", tls: &TLSOptions{CAFile: caFile}},
+		{desc: "ServerName", tls: &TLSOptions{CAPEM: serverCAPEM(s), ServerName: "example.com"}, output: "example.com"},
+		{desc: "PinMatch", tls: &TLSOptions{CAPEM: serverCAPEM(s), PinnedSPKI: []string{"sha256/" + SPKIHash(s.Certificate())}}},
+		{desc: "PinMismatch", tls: &TLSOptions{CAPEM: serverCAPEM(s), PinnedSPKI: []string{"AAAA"}}, fail: true},
+		{desc: "MinVersion", tls: &TLSOptions{CAPEM: serverCAPEM(s), MinVersion: tls.VersionTLS13}},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.TLS = test.tls
+
+			rsp, err := New(opt).Get(s.URL, nil)
+			if test.fail {
+				if err == nil {
+					t.Error("Expected TLS error, but got none error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if output := rsp.String(); output != test.output {
+				t.Errorf("Expected server name [%s], but got [%s]", test.output, output)
+			}
+		})
+	}
+
+	t.Run("Test-InvalidCA", func(t *testing.T) {
+		opt := DefaultOptions()
+		opt.TLS = &TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}
+
+		rsp, err := New(opt).Get(s.URL, nil)
+		if err == nil || !strings.Contains(err.Error(), "couldn't configure client") {
+			t.Errorf("Expected configuration error, but got [%v]", err)
+		}
+		if http.StatusNoContent != rsp.StatusCode {
+			t.Errorf("Expected status code [%d], but got [%d]", http.StatusNoContent, rsp.StatusCode)
+		}
+	})
+}
+
+func TestTLSOptions_ClientCertificate(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	s.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	s.StartTLS()
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+
+	writeClientCert(t, certFile, keyFile, "first", time.Now().Add(-time.Minute))
+
+	opt := DefaultOptions()
+	opt.TLS = &TLSOptions{CAPEM: serverCAPEM(s), CertFile: certFile, KeyFile: keyFile}
+	f := New(opt)
+
+	rsp, err := f.Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "first" {
+		t.Errorf("Expected client certificate [first], but got [%s]", output)
+	}
+
+	// new connection must use the certificate reloaded
+	writeClientCert(t, certFile, keyFile, "second", time.Now())
+	f.Option.Transport.CloseIdleConnections()
+
+	rsp, err = f.Get(s.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "second" {
+		t.Errorf("Expected client certificate [second], but got [%s]", output)
+	}
+}
@@ -0,0 +1,296 @@
+package fetch
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers of W3C Trace Context propagation.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace.
+type SpanID [8]byte
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	// Sampled is the sampled flag of traceparent.
+	Sampled bool
+	// TraceState is the vendor specific tracestate header, kept as received.
+	TraceState string
+	// Remote is true when the span context was extracted from headers.
+	Remote bool
+}
+
+// IsValid reports whether trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent returns the traceparent header of span context.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// Attribute is a key value pair describing a span, values are
+// strings, ints or bools.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts the client span of each request sent by Fetch, see
+// the otelfetch module for the OpenTelemetry adapter.
+type Tracer interface {
+	// Start starts a span child of the span in ctx and returns ctx carrying it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a client span started by Tracer.
+type Span interface {
+	// SpanContext returns the span context propagated in traceparent.
+	SpanContext() SpanContext
+	// SetAttributes adds attrs to span.
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks span as failed by err.
+	RecordError(err error)
+	// End ends span, it's called once.
+	End()
+}
+
+// spanContextKey is the context key of SpanContext
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc, requests sent
+// with it propagate sc or are traced as its children.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the SpanContext of ctx, invalid when none.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// ExtractTraceContext returns a copy of ctx carrying the span context of
+// traceparent and tracestate headers, ctx is returned when they are invalid.
+// It's used by servers to continue the trace of incoming requests.
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	sc, ok := parseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	sc.TraceState = strings.Join(header[http.CanonicalHeaderKey(TracestateHeader)], ",")
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// parseTraceparent parses the traceparent header, versions above 00
+// are parsed as 00 and their extra fields ignored
+func parseTraceparent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	value = strings.TrimSpace(value)
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, false
+	}
+
+	version, err := hex.DecodeString(value[:2])
+	if err != nil || version[0] == 0xff || version[0] == 0 && len(value) != 55 || len(value) > 55 && value[55] != '-' {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(value[3:35])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(value[36:52])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(value[53:55])
+	if err != nil || strings.ToLower(value[:55]) != value[:55] {
+		return sc, false
+	}
+
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, sc.IsValid()
+}
+
+// startSpan starts the client span of req when Options.Tracer is set and
+// injects the trace context in its headers. The parent is the span context
+// of request context or of traceparent already set in req.
+func (f *Fetch) startSpan(req *http.Request) (*http.Request, Span) {
+	parent := SpanContextFromContext(req.Context())
+	if !parent.IsValid() {
+		if sc, ok := parseTraceparent(req.Header.Get(TraceparentHeader)); ok {
+			sc.TraceState = req.Header.Get(TracestateHeader)
+			parent = sc
+		}
+	}
+
+	if f.Option.Tracer == nil {
+		if parent.IsValid() {
+			injectTraceContext(req, parent)
+		}
+		return req, nil
+	}
+
+	ctx := req.Context()
+	if parent.IsValid() {
+		ctx = ContextWithSpanContext(ctx, parent)
+	}
+	ctx, span := f.Option.Tracer.Start(ctx, "HTTP "+req.Method)
+	sc := span.SpanContext()
+	req = req.WithContext(ContextWithSpanContext(ctx, sc))
+
+	span.SetAttributes(
+		Attribute{Key: "http.method", Value: req.Method},
+		Attribute{Key: "http.url", Value: redactURL(req)},
+	)
+	injectTraceContext(req, sc)
+	return req, span
+}
+
+// injectTraceContext sets the traceparent and tracestate headers of req
+func injectTraceContext(req *http.Request, sc SpanContext) {
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		req.Header.Set(TracestateHeader, sc.TraceState)
+	} else {
+		req.Header.Del(TracestateHeader)
+	}
+}
+
+// endSpan records the result of request in span and ends it
+func endSpan(span Span, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+
+	if err != nil {
+		span.RecordError(err)
+	} else {
+		span.SetAttributes(Attribute{Key: "http.status_code", Value: resp.StatusCode})
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.RecordError(fmt.Errorf("%s", resp.Status))
+		}
+	}
+	span.End()
+}
+
+// redactURL returns the URL of req without user info
+func redactURL(req *http.Request) string {
+	u := *req.URL
+	u.User = nil
+	return u.String()
+}
+
+// SpanData is a span recorded by MemoryTracer.
+type SpanData struct {
+	Name        string
+	SpanContext SpanContext
+	Parent      SpanContext
+	Attributes  []Attribute
+	Err         error
+	Start       time.Time
+	End         time.Time
+}
+
+// Attribute returns the value of attribute key, nil when not set.
+func (d SpanData) Attribute(key string) interface{} {
+	for i := len(d.Attributes) - 1; i >= 0; i-- {
+		if d.Attributes[i].Key == key {
+			return d.Attributes[i].Value
+		}
+	}
+	return nil
+}
+
+// MemoryTracer is a Tracer keeping the ended spans in memory, it's
+// meant for tests. The zero value is ready to use.
+type MemoryTracer struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// Start implements Tracer, the span is a child of the span context of ctx
+// or the root of a new sampled trace.
+func (t *MemoryTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID, sc.Sampled, sc.TraceState = parent.TraceID, parent.Sampled, parent.TraceState
+	} else {
+		_, _ = rand.Read(sc.TraceID[:])
+	}
+	_, _ = rand.Read(sc.SpanID[:])
+
+	span := &memorySpan{tracer: t, data: SpanData{Name: name, SpanContext: sc, Parent: parent, Start: time.Now()}}
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Spans returns the spans ended, in order.
+func (t *MemoryTracer) Spans() []SpanData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SpanData(nil), t.spans...)
+}
+
+// Reset drops the spans recorded.
+func (t *MemoryTracer) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.spans = nil
+}
+
+// memorySpan is the Span of MemoryTracer
+type memorySpan struct {
+	tracer *MemoryTracer
+	mu     sync.Mutex
+	data   SpanData
+}
+
+func (s *memorySpan) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *memorySpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+func (s *memorySpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+func (s *memorySpan) End() {
+	s.mu.Lock()
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, data)
+}
@@ -0,0 +1,141 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		desc   string
+		value  string
+		valid  bool
+		parent string
+	}{
+		{desc: "Sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", valid: true},
+		{desc: "NotSampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", valid: true},
+		{desc: "FutureVersion", value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", valid: true,
+			parent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{desc: "InvalidVersion", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{desc: "ExtraFields", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{desc: "ZeroTraceID", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{desc: "ZeroSpanID", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{desc: "Uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{desc: "Short", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+		{desc: "Empty"},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			sc, ok := parseTraceparent(test.value)
+			if ok != test.valid {
+				t.Fatalf("Expected valid [%t], but got [%t]", test.valid, ok)
+			}
+			if !ok {
+				return
+			}
+			expected := test.parent
+			if expected == "" {
+				expected = test.value
+			}
+			if sc.Traceparent() != expected || !sc.Remote {
+				t.Errorf("Expected [%s], but got [%s]", expected, sc.Traceparent())
+			}
+		})
+	}
+}
+
+func TestFetch_Tracer(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Traceparent"), r.Header.Get("Tracestate"))
+	})
+	defer s.Close()
+
+	incoming := http.Header{}
+	incoming.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Set("Tracestate", "congo=t61rcWkgMzE")
+	ctx := ExtractTraceContext(context.Background(), incoming)
+
+	tracer := &MemoryTracer{}
+	opt := DefaultOptions()
+	opt.Tracer = tracer
+	f := New(opt)
+
+	t.Run("Test-Child", func(t *testing.T) {
+		tracer.Reset()
+		rsp, err := f.GetWithContext(ctx, s.URL+"/ok", nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+
+		spans := tracer.Spans()
+		if len(spans) != 1 {
+			t.Fatalf("Expected [1] span, but got [%d]", len(spans))
+		}
+		span := spans[0]
+		if span.Parent.Traceparent() != incoming.Get("Traceparent") || span.SpanContext.TraceID != span.Parent.TraceID {
+			t.Errorf("Expected child of [%s], but got [%s]", incoming.Get("Traceparent"), span.SpanContext.Traceparent())
+		}
+		expected := span.SpanContext.Traceparent() + "|congo=t61rcWkgMzE"
+		if output := rsp.String(); output != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, output)
+		}
+		if span.Name != "HTTP GET" || span.Attribute("http.method") != "GET" ||
+			span.Attribute("http.url") != s.URL+"/ok" || span.Attribute("http.status_code") != http.StatusOK || span.Err != nil {
+			t.Errorf("Expected GET attributes, but got [%+v]", span)
+		}
+	})
+
+	t.Run("Test-Root", func(t *testing.T) {
+		tracer.Reset()
+		rsp, err := f.Get(s.URL+"/fail", nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+
+		span := tracer.Spans()[0]
+		if span.Parent.IsValid() || !span.SpanContext.IsValid() {
+			t.Errorf("Expected root span, but got parent [%s]", span.Parent.Traceparent())
+		}
+		if output := rsp.String(); output != span.SpanContext.Traceparent()+"|" {
+			t.Errorf("Expected [%s|], but got [%s]", span.SpanContext.Traceparent(), output)
+		}
+		if span.Err == nil || span.Attribute("http.status_code") != http.StatusInternalServerError {
+			t.Errorf("Expected error recorded, but got [%+v]", span)
+		}
+	})
+
+	t.Run("Test-Error", func(t *testing.T) {
+		tracer.Reset()
+		_, _ = f.Get("http://127.0.0.1:1/", nil)
+
+		span := tracer.Spans()[0]
+		if span.Err == nil || span.Attribute("http.status_code") != nil {
+			t.Errorf("Expected connection error recorded, but got [%+v]", span)
+		}
+	})
+
+	t.Run("Test-WithoutTracer", func(t *testing.T) {
+		rsp, err := NewDefault().GetWithContext(ctx, s.URL, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		expected := incoming.Get("Traceparent") + "|" + incoming.Get("Tracestate")
+		if output := rsp.String(); output != expected {
+			t.Errorf("Expected [%s], but got [%s]", expected, output)
+		}
+
+		rsp, err = NewDefault().Get(s.URL, nil)
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if output := rsp.String(); output != "|" {
+			t.Errorf("Expected no trace context, but got [%s]", output)
+		}
+	})
+}
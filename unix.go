@@ -0,0 +1,89 @@
+package fetch
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// UnixScheme is the URL scheme of requests sent over Unix domain sockets,
+// the socket path is the escaped host, eg. http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.41/containers/json
+const UnixScheme = "http+unix"
+
+// NewRequest works as http.NewRequest but also accepts UnixScheme URLs.
+func NewRequest(method, rawurl string, body io.Reader) (*http.Request, error) {
+	if !strings.HasPrefix(rawurl, UnixScheme+"://") {
+		return http.NewRequest(method, rawurl, body)
+	}
+
+	// url.Parse refuses escaped slashes in host, the socket path is sent hex encoded
+	rest := strings.TrimPrefix(rawurl, UnixScheme+"://")
+	socket, path := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		socket, path = rest[:i], rest[i:]
+	}
+
+	socketPath, err := url.PathUnescape(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, UnixScheme+"://"+hex.EncodeToString([]byte(socketPath))+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Host = "localhost"
+	return req, nil
+}
+
+// UnixURL returns the UnixScheme URL of path served by the socket.
+func UnixURL(socket, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return UnixScheme + "://" + url.PathEscape(socket) + path
+}
+
+// unixTransport send requests of UnixScheme through the socket encoded in host
+type unixTransport struct {
+	transport *http.Transport
+}
+
+// newUnixTransport returns transport dialing the sockets with dialer
+func newUnixTransport(dialer *net.Dialer) *unixTransport {
+	return &unixTransport{
+		transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				socket, err := hex.DecodeString(host)
+				if err != nil {
+					return nil, err
+				}
+				return dialer.DialContext(ctx, "unix", string(socket))
+			},
+		},
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *unixTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	u.Scheme = "http"
+
+	r := new(http.Request)
+	*r = *req
+	r.URL = &u
+	return t.transport.RoundTrip(r)
+}
+
+// CloseIdleConnections close the idle connections of sockets.
+func (t *unixTransport) CloseIdleConnections() {
+	t.transport.CloseIdleConnections()
+}
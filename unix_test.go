@@ -0,0 +1,118 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// unixServer serve handler in a Unix domain socket and returns its path
+func unixServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, string) {
+	dir, err := ioutil.TempDir("", "fetch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "docker.sock")
+
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewUnstartedServer(handler)
+	s.Listener = l
+	s.Start()
+	return s, socket
+}
+
+func TestNewRequest_Unix(t *testing.T) {
+	req, err := NewRequest(http.MethodGet, "http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.41/containers/json?all=1", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if req.URL.Path != "/v1.41/containers/json" || req.URL.RawQuery != "all=1" {
+		t.Errorf("Expected path and query kept, but got [%s]", req.URL)
+	}
+	if req.Host != "localhost" {
+		t.Errorf("Expected Host [localhost], but got [%s]", req.Host)
+	}
+
+	if url := UnixURL("/var/run/docker.sock", "v1.41/info"); url != "http+unix://%2Fvar%2Frun%2Fdocker.sock/v1.41/info" {
+		t.Errorf("Expected unix URL, but got [%s]", url)
+	}
+
+	if _, err := NewRequest(http.MethodGet, "http+unix://%zz/", nil); err == nil {
+		t.Error("Expected escape error, but got none error")
+	}
+}
+
+func TestFetch_Unix(t *testing.T) {
+	s, socket := unixServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"method":"%s","path":"%s","query":"%s","body":%q}`, r.Method, r.URL.Path, r.URL.RawQuery, body)
+	})
+	defer os.RemoveAll(filepath.Dir(socket))
+	defer s.Close()
+
+	var output struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Query  string `json:"query"`
+		Body   string `json:"body"`
+	}
+
+	f := NewDefault()
+	rsp, err := f.Get(UnixURL(socket, "/v1.41/containers/json?all=1"), nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if err := rsp.Decode(&output); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output.Method != http.MethodGet || output.Path != "/v1.41/containers/json" || output.Query != "all=1" {
+		t.Errorf("Expected GET /v1.41/containers/json?all=1, but got [%+v]", output)
+	}
+
+	rsp, err = f.PostWithContext(context.Background(), UnixURL(socket, "/containers/create"), NewReader("alpine"))
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if err := rsp.Decode(&output); err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output.Method != http.MethodPost || output.Body != `"alpine"` {
+		t.Errorf("Expected POST with body, but got [%+v]", output)
+	}
+}
+
+func TestOptions_Dial(t *testing.T) {
+	s := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Host)
+	})
+	defer s.Close()
+
+	var dialed []string
+	opt := DefaultOptions()
+	opt.Dial = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, s.Listener.Addr().String())
+	}
+
+	rsp, err := New(opt).Get("http://sidecar.fetch.test/health", nil)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	if output := rsp.String(); output != "sidecar.fetch.test" {
+		t.Errorf("Expected [sidecar.fetch.test], but got [%s]", output)
+	}
+	if len(dialed) != 1 || dialed[0] != "sidecar.fetch.test:80" {
+		t.Errorf("Expected dial [sidecar.fetch.test:80], but got [%v]", dialed)
+	}
+}
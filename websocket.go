@@ -0,0 +1,646 @@
+package fetch
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// DefaultMaxMessageSize is the largest message read by a WebSocket when
+// WebSocketOptions.MaxMessageSize is not set.
+const DefaultMaxMessageSize = 1 << 20
+
+// DefaultCloseTimeout is the time waiting the close frame of server.
+const DefaultCloseTimeout = 5 * time.Second
+
+// websocketGUID is concatenated to the key to compute Sec-WebSocket-Accept
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var (
+	// ErrBadHandshake returns when the server refuses the WebSocket upgrade
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+	// ErrCloseSent returns when a message is written after the close frame
+	ErrCloseSent = errors.New("websocket: close sent")
+)
+
+// MessageType is the opcode of WebSocket frames.
+type MessageType int
+
+// Message types of RFC 6455.
+const (
+	continuationFrame MessageType = 0
+	// TextMessage is an UTF-8 encoded message
+	TextMessage MessageType = 1
+	// BinaryMessage is a binary message
+	BinaryMessage MessageType = 2
+	// CloseMessage starts the close handshake
+	CloseMessage MessageType = 8
+	// PingMessage is answered by a PongMessage
+	PingMessage MessageType = 9
+	// PongMessage answers a PingMessage
+	PongMessage MessageType = 10
+)
+
+// Close codes of RFC 6455.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseUnsupportedData = 1003
+	CloseNoStatus        = 1005
+	CloseAbnormal        = 1006
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// CloseError is the close frame received or sent because of an error.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+// WebSocketOptions configure the WebSocket connections of Fetch.WebSocket.
+type WebSocketOptions struct {
+	// Subprotocols are sent in Sec-WebSocket-Protocol by preference order.
+	Subprotocols []string
+	// MaxMessageSize is the largest message read, DefaultMaxMessageSize when zero.
+	MaxMessageSize int64
+	// FrameSize splits messages written in fragments, messages are not fragmented when zero.
+	FrameSize int
+	// PingInterval is the interval of pings sent to keep the connection alive, disabled when zero.
+	PingInterval time.Duration
+	// PongTimeout is the time waiting a pong after a ping before the connection is closed,
+	// pongs are received while messages are read. Disabled when zero.
+	PongTimeout time.Duration
+	// CloseTimeout is the time waiting the close frame of server, DefaultCloseTimeout when zero.
+	CloseTimeout time.Duration
+}
+
+// WebSocket is a client WebSocket connection. Messages are read by one goroutine
+// at time and can be written by many goroutines.
+type WebSocket struct {
+	// lastPong is the unix nano time of last pong, first for 64-bit alignment
+	lastPong int64
+
+	conn        io.ReadWriteCloser
+	reader      *bufio.Reader
+	server      bool
+	subprotocol string
+	opt         WebSocketOptions
+
+	// readLock is held while a message is read
+	readLock chan struct{}
+	readErr  error
+
+	writeMu   sync.Mutex
+	closeSent bool
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// WebSocket open a WebSocket connection to url with ws, wss, http or https scheme.
+// The upgrade request uses the transport, headers and authenticator of Options,
+// ctx limits the handshake only.
+func (f *Fetch) WebSocket(ctx context.Context, url string) (*WebSocket, error) {
+	opt := WebSocketOptions{}
+	if f.Option.WebSocket != nil {
+		opt = *f.Option.WebSocket
+	}
+
+	switch {
+	case strings.HasPrefix(url, "ws://"):
+		url = "http://" + strings.TrimPrefix(url, "ws://")
+	case strings.HasPrefix(url, "wss://"):
+		url = "https://" + strings.TrimPrefix(url, "wss://")
+	}
+
+	req, err := NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't request websocket: %s", err)
+	}
+
+	key, err := newWebSocketKey()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't request websocket: %s", err)
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(opt.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(opt.Subprotocols, ", "))
+	}
+
+	// the connection outlives the client timeout and must not negotiate HTTP/2
+	client := f.streamClient()
+	client.Transport = f.websocket
+
+	rsp, err := f.do(req.WithContext(ctx), func(req *http.Request) (*http.Response, error) {
+		return ctxhttp.Do(req.Context(), client, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conn, ok := rsp.Body.(io.ReadWriteCloser)
+	if err := checkHandshake(rsp.Response, key, opt.Subprotocols); err != nil || !ok {
+		_ = rsp.Body.Close()
+		if err == nil {
+			err = fmt.Errorf("%w: connection can't be written", ErrBadHandshake)
+		}
+		return nil, err
+	}
+
+	ws := newWebSocket(conn, false, opt)
+	ws.subprotocol = rsp.Header.Get("Sec-WebSocket-Protocol")
+	return ws, nil
+}
+
+// websocketTransport returns a copy of transport which speaks HTTP/1.1 only. The
+// protocols registered in transport are not copied: UnixScheme is registered again
+// with a dialer of timeout and h2c is left out, as the upgrade needs HTTP/1.1.
+func websocketTransport(transport *http.Transport, timeout time.Duration) *http.Transport {
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+
+	transport = transport.Clone()
+	transport.RegisterProtocol(UnixScheme, newUnixTransport(&net.Dialer{Timeout: timeout}))
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	if transport.TLSClientConfig != nil {
+		transport.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	return transport
+}
+
+// newWebSocketKey returns a random Sec-WebSocket-Key
+func newWebSocketKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept of key
+func websocketAccept(key string) string {
+	h := sha1.New()
+	_, _ = io.WriteString(h, key+websocketGUID)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// checkHandshake validate the upgrade response of RFC 6455
+func checkHandshake(resp *http.Response, key string, subprotocols []string) error {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("%w: unexpected status %s", ErrBadHandshake, resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") || !headerContains(resp.Header, "Connection", "upgrade") {
+		return fmt.Errorf("%w: missing upgrade headers", ErrBadHandshake)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return fmt.Errorf("%w: invalid Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+	if resp.Header.Get("Sec-WebSocket-Extensions") != "" {
+		return fmt.Errorf("%w: unexpected extensions", ErrBadHandshake)
+	}
+
+	if protocol := resp.Header.Get("Sec-WebSocket-Protocol"); protocol != "" {
+		for _, p := range subprotocols {
+			if p == protocol {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: unexpected subprotocol %s", ErrBadHandshake, protocol)
+	}
+	return nil
+}
+
+// headerContains reports whether the comma-separated header has token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newWebSocket returns a WebSocket over conn, server connections don't mask frames
+func newWebSocket(conn io.ReadWriteCloser, server bool, opt WebSocketOptions) *WebSocket {
+	if opt.MaxMessageSize <= 0 {
+		opt.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if opt.CloseTimeout <= 0 {
+		opt.CloseTimeout = DefaultCloseTimeout
+	}
+
+	ws := &WebSocket{
+		lastPong: time.Now().UnixNano(),
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		server:   server,
+		opt:      opt,
+		readLock: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+
+	if opt.PingInterval > 0 {
+		go ws.keepalive()
+	}
+	return ws
+}
+
+// Subprotocol returns the subprotocol selected by server.
+func (ws *WebSocket) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// ReadMessage returns the next text or binary message, fragments are joined.
+// Pings are answered and pongs recorded while reading. It returns a *CloseError
+// when the connection is closed by a close frame.
+func (ws *WebSocket) ReadMessage() (MessageType, []byte, error) {
+	ws.readLock <- struct{}{}
+	defer func() { <-ws.readLock }()
+
+	return ws.readMessage()
+}
+
+// readMessage read the next message, the caller holds readLock
+func (ws *WebSocket) readMessage() (MessageType, []byte, error) {
+	if ws.readErr != nil {
+		return 0, nil, ws.readErr
+	}
+
+	var (
+		typ     MessageType
+		message []byte
+	)
+
+	for {
+		fin, op, payload, err := ws.readFrame(int64(len(message)))
+		if err != nil {
+			return 0, nil, ws.failRead(err)
+		}
+
+		switch op {
+		case PingMessage:
+			if err := ws.writeControl(PongMessage, payload); err != nil && err != ErrCloseSent {
+				return 0, nil, ws.failRead(err)
+			}
+			continue
+		case PongMessage:
+			atomic.StoreInt64(&ws.lastPong, time.Now().UnixNano())
+			continue
+		case CloseMessage:
+			return 0, nil, ws.failRead(ws.receiveClose(payload))
+		case continuationFrame:
+			if typ == 0 {
+				return 0, nil, ws.failRead(&CloseError{Code: CloseProtocolError, Reason: "unexpected continuation frame"})
+			}
+		case TextMessage, BinaryMessage:
+			if typ != 0 {
+				return 0, nil, ws.failRead(&CloseError{Code: CloseProtocolError, Reason: "expected continuation frame"})
+			}
+			typ = op
+		default:
+			return 0, nil, ws.failRead(&CloseError{Code: CloseProtocolError, Reason: fmt.Sprintf("unknown opcode %d", op)})
+		}
+
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+
+		if typ == TextMessage && !utf8.Valid(message) {
+			return 0, nil, ws.failRead(&CloseError{Code: CloseInvalidPayload, Reason: "invalid UTF-8"})
+		}
+		if message == nil {
+			message = []byte{}
+		}
+		return typ, message, nil
+	}
+}
+
+// readFrame read a frame, read is the size of message already read
+func (ws *WebSocket) readFrame(read int64) (fin bool, op MessageType, payload []byte, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(ws.reader, header[:2]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin = header[0]&0x80 != 0
+	op = MessageType(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "unexpected reserved bits"}
+	}
+	if masked != ws.server {
+		return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid frame mask"}
+	}
+
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(ws.reader, header[:2]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(header[:2]))
+	case 127:
+		if _, err := io.ReadFull(ws.reader, header[:8]); err != nil {
+			return false, 0, nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(header[:8]))
+		if length < 0 {
+			return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid frame length"}
+		}
+	}
+
+	if op >= CloseMessage {
+		if !fin || length > 125 {
+			return false, 0, nil, &CloseError{Code: CloseProtocolError, Reason: "invalid control frame"}
+		}
+	} else if length > ws.opt.MaxMessageSize-read {
+		return false, 0, nil, &CloseError{Code: CloseMessageTooBig, Reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(ws.reader, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskBytes(mask, payload)
+	}
+	return fin, op, payload, nil
+}
+
+// receiveClose answer the close frame of peer and returns its CloseError
+func (ws *WebSocket) receiveClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatus}
+	switch {
+	case len(payload) == 1:
+		closeErr = &CloseError{Code: CloseProtocolError, Reason: "invalid close frame"}
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) || !utf8.Valid(payload[2:]) {
+			closeErr = &CloseError{Code: CloseProtocolError, Reason: "invalid close frame"}
+		}
+	}
+
+	code := closeErr.Code
+	if code == CloseNoStatus {
+		code = CloseNormal
+	}
+	_ = ws.writeClose(code, "")
+	ws.closeConn()
+	return closeErr
+}
+
+// validCloseCode reports whether code can be sent in a close frame
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// failRead keeps err for the next reads and sends the close frame of protocol errors
+func (ws *WebSocket) failRead(err error) error {
+	if closeErr, ok := err.(*CloseError); ok {
+		_ = ws.writeClose(closeErr.Code, closeErr.Reason)
+	} else {
+		// the connection closed without close frame
+		select {
+		case <-ws.closed:
+		default:
+			err = &CloseError{Code: CloseAbnormal, Reason: err.Error()}
+		}
+	}
+
+	if ws.readErr == nil {
+		ws.readErr = err
+	}
+	ws.closeConn()
+	return ws.readErr
+}
+
+// WriteMessage writes a text or binary message, split in fragments of WebSocketOptions.FrameSize.
+func (ws *WebSocket) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", typ)
+	}
+	if typ == TextMessage && !utf8.Valid(data) {
+		return errors.New("websocket: invalid UTF-8 in text message")
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+
+	size := ws.opt.FrameSize
+	if size <= 0 || size > len(data) {
+		size = len(data)
+	}
+
+	op := typ
+	for {
+		frame := data[:size]
+		data = data[size:]
+		if len(data) < size {
+			size = len(data)
+		}
+
+		if err := ws.writeFrame(len(data) == 0, op, frame); err != nil {
+			return err
+		}
+		if len(data) == 0 {
+			return nil
+		}
+		op = continuationFrame
+	}
+}
+
+// Ping sends a ping with data, the pong is received while messages are read.
+func (ws *WebSocket) Ping(data []byte) error {
+	return ws.writeControl(PingMessage, data)
+}
+
+// writeControl writes a ping or pong frame
+func (ws *WebSocket) writeControl(op MessageType, data []byte) error {
+	if len(data) > 125 {
+		return errors.New("websocket: control frame too long")
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	return ws.writeFrame(true, op, data)
+}
+
+// writeClose writes the close frame once
+func (ws *WebSocket) writeClose(code int, reason string) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if ws.closeSent {
+		return ErrCloseSent
+	}
+	ws.closeSent = true
+
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > 125 {
+		payload = payload[:125]
+	}
+	return ws.writeFrame(true, CloseMessage, payload)
+}
+
+// writeFrame writes a frame in a single write, the caller holds writeMu
+func (ws *WebSocket) writeFrame(fin bool, op MessageType, payload []byte) error {
+	frame := make([]byte, 0, 14+len(payload))
+
+	b0 := byte(op)
+	if fin {
+		b0 |= 0x80
+	}
+	frame = append(frame, b0)
+
+	var b1 byte
+	if !ws.server {
+		b1 = 0x80
+	}
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, b1|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, b1|126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(length))
+	default:
+		frame = append(frame, b1|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(length))
+	}
+
+	start := len(frame)
+	if !ws.server {
+		var mask [4]byte
+		if _, err := io.ReadFull(rand.Reader, mask[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mask[:]...)
+		start += 4
+		frame = append(frame, payload...)
+		maskBytes(mask, frame[start:])
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := ws.conn.Write(frame)
+	return err
+}
+
+// maskBytes applies the masking key to payload
+func maskBytes(mask [4]byte, payload []byte) {
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+}
+
+// Close starts the close handshake with code and reason, and waits the close
+// frame of server up to WebSocketOptions.CloseTimeout before closing the connection.
+func (ws *WebSocket) Close(code int, reason string) error {
+	err := ws.writeClose(code, reason)
+	if err == ErrCloseSent {
+		err = nil
+	}
+
+	timer := time.AfterFunc(ws.opt.CloseTimeout, ws.closeConn)
+	defer timer.Stop()
+
+	select {
+	case ws.readLock <- struct{}{}:
+		// none reader, discard messages until the close frame
+		for {
+			if _, _, err := ws.readMessage(); err != nil {
+				break
+			}
+		}
+		<-ws.readLock
+	case <-ws.closed:
+	}
+
+	// the reader receives the close frame
+	<-ws.closed
+	return err
+}
+
+// closeConn closes the connection once
+func (ws *WebSocket) closeConn() {
+	ws.closeOnce.Do(func() {
+		close(ws.closed)
+		_ = ws.conn.Close()
+	})
+}
+
+// keepalive sends pings and closes the connection when pongs are late
+func (ws *WebSocket) keepalive() {
+	ticker := time.NewTicker(ws.opt.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ws.closed:
+			return
+		case <-ticker.C:
+		}
+
+		lastPong := time.Unix(0, atomic.LoadInt64(&ws.lastPong))
+		if ws.opt.PongTimeout > 0 && time.Since(lastPong) > ws.opt.PingInterval+ws.opt.PongTimeout {
+			ws.closeConn()
+			return
+		}
+
+		if err := ws.Ping(nil); err != nil {
+			return
+		}
+	}
+}
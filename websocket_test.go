@@ -0,0 +1,321 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// websocketServer upgrades the requests and runs handler with the server side connection
+func websocketServer(handler func(ws *WebSocket, r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !headerContains(r.Header, "Connection", "upgrade") || r.Header.Get("Sec-WebSocket-Version") != "13" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n", websocketAccept(r.Header.Get("Sec-WebSocket-Key")))
+		if protocols := r.Header.Get("Sec-WebSocket-Protocol"); protocols != "" {
+			fmt.Fprintf(rw, "Sec-WebSocket-Protocol: %s\r\n", strings.Split(protocols, ",")[0])
+		}
+		fmt.Fprint(rw, "\r\n")
+		_ = rw.Flush()
+
+		handler(newWebSocket(conn, true, WebSocketOptions{CloseTimeout: time.Second}), r)
+	}
+}
+
+// echo writes back the messages received until the connection is closed
+func echo(ws *WebSocket, r *http.Request) {
+	for {
+		typ, message, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := ws.WriteMessage(typ, message); err != nil {
+			return
+		}
+	}
+}
+
+func TestFetch_WebSocket(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	s := serverHandlerMock(websocketServer(func(ws *WebSocket, r *http.Request) {
+		headers <- r.Header
+		echo(ws, r)
+	}))
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.Timeout = 50 * time.Millisecond
+	opt.Header.Set("X-Client", "fetch")
+	opt.Auth = BearerAuth{Token: "token"}
+	opt.WebSocket = &WebSocketOptions{Subprotocols: []string{"chat", "json"}, FrameSize: 3}
+
+	ws, err := New(opt).WebSocket(context.Background(), strings.Replace(s.URL, "http://", "ws://", 1))
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	if header := <-headers; header.Get("Authorization") != "Bearer token" || header.Get("X-Client") != "fetch" {
+		t.Errorf("Expected headers and authentication, but got [%v]", header)
+	}
+	if ws.Subprotocol() != "chat" {
+		t.Errorf("Expected subprotocol [chat], but got [%s]", ws.Subprotocol())
+	}
+
+	tests := []struct {
+		typ  MessageType
+		data []byte
+	}{
+		{typ: TextMessage, data: []byte("hello, fragmented world")},
+		{typ: BinaryMessage, data: []byte{0, 1, 2}},
+		{typ: BinaryMessage, data: bytes.Repeat([]byte("x"), 70000)},
+		{typ: TextMessage, data: []byte{}},
+	}
+
+	// outlives the client timeout
+	time.Sleep(100 * time.Millisecond)
+
+	for _, test := range tests {
+		if err := ws.WriteMessage(test.typ, test.data); err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		typ, data, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		if typ != test.typ || !bytes.Equal(data, test.data) {
+			t.Errorf("Expected message [%d] of [%d] bytes, but got [%d] of [%d] bytes", test.typ, len(test.data), typ, len(data))
+		}
+	}
+
+	if err := ws.WriteMessage(TextMessage, []byte{0xff}); err == nil {
+		t.Error("Expected invalid UTF-8 error, but got none error")
+	}
+
+	if err := ws.Close(CloseNormal, "bye"); err != nil {
+		t.Errorf("Expected none error, but got [%s]", err)
+	}
+	if err := ws.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+		t.Errorf("Expected [%s], but got [%v]", ErrCloseSent, err)
+	}
+}
+
+func TestFetch_WebSocketUnix(t *testing.T) {
+	s, socket := unixServer(t, websocketServer(echo))
+	defer os.RemoveAll(filepath.Dir(socket))
+	defer s.Close()
+
+	tests := []struct {
+		desc     string
+		protocol Protocol
+	}{
+		{desc: "HTTP2", protocol: ProtocolHTTP2},
+		{desc: "H2C", protocol: ProtocolH2C},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			opt := DefaultOptions()
+			opt.Protocol = test.protocol
+			f := New(opt)
+			defer f.Close()
+
+			ws, err := f.WebSocket(context.Background(), UnixURL(socket, "/ws"))
+			if err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			defer ws.Close(CloseNormal, "")
+
+			if err := ws.WriteMessage(TextMessage, []byte("unix")); err != nil {
+				t.Fatalf("Expected none error, but got [%s]", err)
+			}
+			if _, data, err := ws.ReadMessage(); err != nil || string(data) != "unix" {
+				t.Errorf("Expected [unix], but got [%s] [%v]", data, err)
+			}
+		})
+	}
+}
+
+func TestWebSocket_Close(t *testing.T) {
+	received := make(chan error, 1)
+	s := serverHandlerMock(websocketServer(func(ws *WebSocket, r *http.Request) {
+		switch r.URL.Path {
+		case "/going-away":
+			_ = ws.Close(CloseGoingAway, "restart")
+		case "/too-big":
+			_ = ws.WriteMessage(BinaryMessage, make([]byte, 100))
+			_, _, err := ws.ReadMessage()
+			received <- err
+		case "/ping":
+			_ = ws.Ping([]byte("keepalive"))
+			echo(ws, r)
+		}
+	}))
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.WebSocket = &WebSocketOptions{MaxMessageSize: 10}
+	f := New(opt)
+
+	t.Run("Test-ServerClose", func(t *testing.T) {
+		ws, err := f.WebSocket(context.Background(), s.URL+"/going-away")
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		_, _, err = ws.ReadMessage()
+		if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != CloseGoingAway || closeErr.Reason != "restart" {
+			t.Errorf("Expected close [1001 restart], but got [%v]", err)
+		}
+		if _, _, again := ws.ReadMessage(); again != err {
+			t.Errorf("Expected [%v] again, but got [%v]", err, again)
+		}
+	})
+
+	t.Run("Test-MessageTooBig", func(t *testing.T) {
+		ws, err := f.WebSocket(context.Background(), s.URL+"/too-big")
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		_, _, err = ws.ReadMessage()
+		if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != CloseMessageTooBig {
+			t.Errorf("Expected close [1009], but got [%v]", err)
+		}
+		if err := <-received; err == nil || err.(*CloseError).Code != CloseMessageTooBig {
+			t.Errorf("Expected server close [1009], but got [%v]", err)
+		}
+	})
+
+	t.Run("Test-Ping", func(t *testing.T) {
+		ws, err := f.WebSocket(context.Background(), s.URL+"/ping")
+		if err != nil {
+			t.Fatalf("Expected none error, but got [%s]", err)
+		}
+		before := atomic.LoadInt64(&ws.lastPong)
+
+		// the server ping is answered while reading
+		_ = ws.Ping(nil)
+		_ = ws.WriteMessage(TextMessage, []byte("ok"))
+		if _, data, err := ws.ReadMessage(); err != nil || string(data) != "ok" {
+			t.Errorf("Expected [ok], but got [%s] [%v]", data, err)
+		}
+		if atomic.LoadInt64(&ws.lastPong) == before {
+			t.Error("Expected pong received, but got none")
+		}
+		_ = ws.Close(CloseNormal, "")
+	})
+}
+
+// frameConn reads the frames of Reader and discards the frames written
+type frameConn struct {
+	io.Reader
+}
+
+func (frameConn) Write(p []byte) (int, error) { return len(p), nil }
+
+func (frameConn) Close() error { return nil }
+
+func TestWebSocket_FrameLength(t *testing.T) {
+	tests := []struct {
+		desc   string
+		length uint64
+		code   int
+	}{
+		{desc: "Overflow", length: 1<<63 - 1, code: CloseMessageTooBig},
+		{desc: "Negative", length: 1 << 63, code: CloseProtocolError},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("Test-%s", test.desc), func(t *testing.T) {
+			var frames bytes.Buffer
+			// a text frame without fin and a continuation frame declaring 64-bit length
+			frames.Write([]byte{byte(TextMessage), 5})
+			frames.WriteString("hello")
+			frames.Write([]byte{0x80, 127})
+			_ = binary.Write(&frames, binary.BigEndian, test.length)
+
+			ws := newWebSocket(frameConn{Reader: &frames}, false, WebSocketOptions{CloseTimeout: time.Millisecond})
+			_, _, err := ws.ReadMessage()
+			if closeErr, ok := err.(*CloseError); !ok || closeErr.Code != test.code {
+				t.Errorf("Expected close [%d], but got [%v]", test.code, err)
+			}
+		})
+	}
+}
+
+func TestWebSocket_Keepalive(t *testing.T) {
+	s := serverHandlerMock(websocketServer(func(ws *WebSocket, r *http.Request) {
+		// reads frames without answering the pings
+		for {
+			if _, _, _, err := ws.readFrame(0); err != nil {
+				return
+			}
+		}
+	}))
+	defer s.Close()
+
+	opt := DefaultOptions()
+	opt.WebSocket = &WebSocketOptions{PingInterval: 20 * time.Millisecond, PongTimeout: 20 * time.Millisecond}
+
+	ws, err := New(opt).WebSocket(context.Background(), s.URL)
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+
+	select {
+	case <-ws.closed:
+	case <-time.After(time.Second):
+		t.Error("Expected connection closed, but got opened")
+	}
+}
+
+func TestFetch_WebSocketHandshake(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(websocketServer(echo))
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	plain := serverHandlerMock(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "not a websocket")
+	})
+	defer plain.Close()
+
+	opt := DefaultOptions()
+	opt.TLS = &TLSOptions{CAPEM: serverCAPEM(tlsServer)}
+	f := New(opt)
+
+	ws, err := f.WebSocket(context.Background(), strings.Replace(tlsServer.URL, "https://", "wss://", 1))
+	if err != nil {
+		t.Fatalf("Expected none error, but got [%s]", err)
+	}
+	_ = ws.WriteMessage(TextMessage, []byte("secure"))
+	if _, data, err := ws.ReadMessage(); err != nil || string(data) != "secure" {
+		t.Errorf("Expected [secure], but got [%s] [%v]", data, err)
+	}
+	_ = ws.Close(CloseNormal, "")
+
+	if _, err := f.WebSocket(context.Background(), plain.URL); !errors.Is(err, ErrBadHandshake) {
+		t.Errorf("Expected [%s], but got [%v]", ErrBadHandshake, err)
+	}
+
+	if accept := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Expected RFC 6455 accept, but got [%s]", accept)
+	}
+}